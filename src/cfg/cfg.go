@@ -0,0 +1,348 @@
+package cfg
+
+import (
+	mod "upt/core/module"
+
+	lk "upt/core/lexeme/lexkind"
+	nk "upt/core/module/nodekind"
+
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Block é um bloco basico do grafo: uma sequencia de comandos
+// (ou condições) que sempre executam juntos
+type Block struct {
+	ID    int
+	Nodes []*mod.Node
+	Succ  []*Block
+	Pred  []*Block
+
+	Visited bool
+}
+
+func (this *Block) String() string {
+	succ := []string{}
+	for _, b := range this.Succ {
+		succ = append(succ, strconv.Itoa(b.ID))
+	}
+	return fmt.Sprintf("b%v (%v nodes) -> [%v]",
+		this.ID, len(this.Nodes), strings.Join(succ, ", "))
+}
+
+type Graph struct {
+	Proc   *mod.Symbol
+	Entry  *Block
+	Exit   *Block
+	Blocks []*Block
+
+	// End é o bloco onde o corpo do procedimento termina,
+	// se ele for alcançavel o procedimento pode terminar sem 'retorne'
+	End *Block
+
+	// Starts guarda o bloco onde cada comando começa
+	Starts map[*mod.Node]*Block
+}
+
+func (this *Graph) String() string {
+	output := []string{}
+	for _, b := range this.Blocks {
+		output = append(output, b.String())
+	}
+	return this.Proc.Name + ":\n" + strings.Join(output, "\n")
+}
+
+// Reachable retorna se o bloco pode ser alcançado a partir da entrada,
+// só é valido depois de ComputeReachability
+func (this *Graph) Reachable(b *Block) bool {
+	return b.Visited
+}
+
+func (this *Graph) ComputeReachability() {
+	for _, b := range this.Blocks {
+		b.Visited = false
+	}
+	visit(this.Entry)
+}
+
+func visit(b *Block) {
+	if b.Visited {
+		return
+	}
+	b.Visited = true
+	for _, s := range b.Succ {
+		visit(s)
+	}
+}
+
+func (this *Graph) newBlock() *Block {
+	b := &Block{
+		ID:    len(this.Blocks),
+		Nodes: []*mod.Node{},
+		Succ:  []*Block{},
+		Pred:  []*Block{},
+	}
+	this.Blocks = append(this.Blocks, b)
+	return b
+}
+
+func link(from, to *Block) {
+	from.Succ = append(from.Succ, to)
+	to.Pred = append(to.Pred, from)
+}
+
+type builder struct {
+	G    *Graph
+	Curr *Block
+
+	// laços que envolvem o comando atual, o ultimo é o mais interno
+	Loops []*loop
+}
+
+// loop guarda os destinos de 'pare' e 'continue'
+type loop struct {
+	Break    *Block
+	Continue *Block
+}
+
+func (this *builder) pushLoop(brk, cont *Block) {
+	this.Loops = append(this.Loops, &loop{Break: brk, Continue: cont})
+}
+
+func (this *builder) popLoop() {
+	this.Loops = this.Loops[:len(this.Loops)-1]
+}
+
+// Build constroi o grafo de fluxo de controle de um procedimento
+// a partir da arvore tipada
+func Build(sy *mod.Symbol) *Graph {
+	g := &Graph{
+		Proc:   sy,
+		Blocks: []*Block{},
+		Starts: map[*mod.Node]*Block{},
+	}
+	g.Entry = g.newBlock()
+	g.Exit = g.newBlock()
+	b := &builder{G: g, Curr: g.Entry}
+
+	// proc := {id, args, retNode, bl}
+	bl := sy.N.Leaves[3]
+	buildBlock(b, bl)
+
+	g.End = b.Curr
+	link(g.End, g.Exit)
+	g.ComputeReachability()
+	return g
+}
+
+func buildBlock(b *builder, bl *mod.Node) {
+	for _, cmd := range bl.Leaves {
+		buildCmd(b, cmd)
+	}
+}
+
+func buildCmd(b *builder, n *mod.Node) {
+	b.G.Starts[n] = b.Curr
+	switch n.Kind {
+	case nk.Terminal:
+		switch n.Lexeme.Kind {
+		case lk.Se:
+			buildSe(b, n)
+			return
+		case lk.Enquanto:
+			buildEnquanto(b, n)
+			return
+		case lk.Faca:
+			buildFaca(b, n)
+			return
+		case lk.Escolha:
+			buildEscolha(b, n)
+			return
+		case lk.Para:
+			buildPara(b, n)
+			return
+		case lk.Retorne:
+			buildRetorne(b, n)
+			return
+		case lk.Pare, lk.Continue:
+			buildSalto(b, n)
+			return
+		}
+	case nk.CountedLoop:
+		buildParaDe(b, n)
+		return
+	case nk.Block:
+		buildBlock(b, n)
+		return
+	}
+	b.Curr.Nodes = append(b.Curr.Nodes, n)
+}
+
+func buildSe(b *builder, n *mod.Node) {
+	// se := {cond, block, senao}
+	cond := b.Curr
+	cond.Nodes = append(cond.Nodes, n.Leaves[0])
+	exit := b.G.newBlock()
+
+	then := b.G.newBlock()
+	link(cond, then)
+	b.Curr = then
+	buildBlock(b, n.Leaves[1])
+	link(b.Curr, exit)
+
+	sn := n.Leaves[2]
+	if sn != nil {
+		senao := b.G.newBlock()
+		link(cond, senao)
+		b.Curr = senao
+		buildBlock(b, sn)
+		link(b.Curr, exit)
+	} else {
+		link(cond, exit)
+	}
+	b.Curr = exit
+}
+
+func buildEscolha(b *builder, n *mod.Node) {
+	// escolha := {expr, caso...}
+	cond := b.Curr
+	cond.Nodes = append(cond.Nodes, n.Leaves[0])
+	exit := b.G.newBlock()
+
+	hasDefault := false
+	for _, c := range n.Leaves[1:] {
+		// caso := {labels, block}
+		// outrocaso := {block}
+		if c.Lexeme.Kind == lk.Outrocaso {
+			hasDefault = true
+		}
+		body := b.G.newBlock()
+		link(cond, body)
+		b.Curr = body
+		buildBlock(b, c.Leaves[len(c.Leaves)-1])
+		link(b.Curr, exit)
+	}
+	// sem 'outrocaso', o valor pode não cair em nenhum caso
+	if !hasDefault {
+		link(cond, exit)
+	}
+	b.Curr = exit
+}
+
+func buildEnquanto(b *builder, n *mod.Node) {
+	// enquanto := {cond, block}
+	buildLoop(b, n.Leaves[0], n.Leaves[1], nil)
+}
+
+// o corpo sempre executa ao menos uma vez,
+// e a condição é testada no fim de cada iteração
+func buildFaca(b *builder, n *mod.Node) {
+	// faca := {block, cond}
+	bodyBlock := b.G.newBlock()
+	condBlock := b.G.newBlock()
+	exit := b.G.newBlock()
+	link(b.Curr, bodyBlock)
+
+	b.Curr = bodyBlock
+	b.pushLoop(exit, condBlock)
+	buildBlock(b, n.Leaves[0])
+	b.popLoop()
+	link(b.Curr, condBlock)
+
+	cond := n.Leaves[1]
+	condBlock.Nodes = append(condBlock.Nodes, cond)
+	link(condBlock, bodyBlock)
+	if !IsAlwaysTrue(cond) {
+		link(condBlock, exit)
+	}
+	b.Curr = exit
+}
+
+func buildPara(b *builder, n *mod.Node) {
+	// para := {atrib, cond, atrib, block}
+	if n.Leaves[0] != nil {
+		b.Curr.Nodes = append(b.Curr.Nodes, n.Leaves[0])
+	}
+	buildLoop(b, n.Leaves[1], n.Leaves[3], n.Leaves[2])
+}
+
+// a variavel do laço faz o papel da condição e do passo,
+// já que os dois só leem e escrevem nela. O proprio nó do laço
+// fica depois dos limites, representando a atribuição 'id = inicio'
+func buildParaDe(b *builder, n *mod.Node) {
+	// paraDe := {id, inicio, fim, passo, block}
+	for _, leaf := range n.Leaves[1:4] {
+		if leaf != nil {
+			b.Curr.Nodes = append(b.Curr.Nodes, leaf)
+		}
+	}
+	b.Curr.Nodes = append(b.Curr.Nodes, n)
+	id := n.Leaves[0]
+	buildLoop(b, id, n.Leaves[4], id)
+}
+
+// buildLoop constroi um laço que testa 'cond' antes de cada iteração,
+// 'step' pode ser nil
+func buildLoop(b *builder, cond, body, step *mod.Node) {
+	condBlock := b.G.newBlock()
+	link(b.Curr, condBlock)
+	condBlock.Nodes = append(condBlock.Nodes, cond)
+
+	exit := b.G.newBlock()
+	bodyBlock := b.G.newBlock()
+	link(condBlock, bodyBlock)
+	// um laço com condição constantemente verdadeira só termina
+	// por dentro do corpo
+	if !IsAlwaysTrue(cond) {
+		link(condBlock, exit)
+	}
+
+	// 'continue' vai pro passo, se existir, senão direto pra condição
+	next := condBlock
+	if step != nil {
+		next = b.G.newBlock()
+		next.Nodes = append(next.Nodes, step)
+		link(next, condBlock)
+	}
+
+	b.Curr = bodyBlock
+	b.pushLoop(exit, next)
+	buildBlock(b, body)
+	b.popLoop()
+	link(b.Curr, next)
+	b.Curr = exit
+}
+
+func buildRetorne(b *builder, n *mod.Node) {
+	b.Curr.Nodes = append(b.Curr.Nodes, n)
+	link(b.Curr, b.G.Exit)
+	// o que vier depois do retorne começa num bloco sem predecessores
+	b.Curr = b.G.newBlock()
+}
+
+func buildSalto(b *builder, n *mod.Node) {
+	l := b.Loops[len(b.Loops)-1]
+	b.Curr.Nodes = append(b.Curr.Nodes, n)
+	if n.Lexeme.Kind == lk.Pare {
+		link(b.Curr, l.Break)
+	} else {
+		link(b.Curr, l.Continue)
+	}
+	// assim como no retorne, o resto do bloco é inalcançavel
+	b.Curr = b.G.newBlock()
+}
+
+// IsAlwaysTrue reconhece condições constantes como 'enquanto (verdadeiro)'
+func IsAlwaysTrue(cond *mod.Node) bool {
+	if cond.Kind != nk.Terminal || cond.Lexeme == nil {
+		return false
+	}
+	switch cond.Lexeme.Kind {
+	case lk.Verdadeiro:
+		return true
+	case lk.IntLit, lk.CharLit:
+		return cond.Lexeme.Value.(int64) != 0
+	}
+	return false
+}
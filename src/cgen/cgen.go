@@ -13,10 +13,10 @@ import (
 	"strings"
 )
 
-//TODO: REQ: gerar código pras funções RAIZ e EXPO
 func Gen(m *mod.Module) string {
 	ctx := newCtx(m)
 	return defaultHeaders +
+		genGlobals(ctx) +
 		forwardDecl(ctx) +
 		genMain(ctx) +
 		genFunctions(ctx)
@@ -24,12 +24,193 @@ func Gen(m *mod.Module) string {
 
 const defaultHeaders = `
 #include <stdio.h>
+#include <stdlib.h>
+#include <stdbool.h>
+#include <string.h>
 #include <math.h>
+#include <time.h>
+
+static int upt_indice(int i, int tamanho, const char *local, const char *nome) {
+	if (i < 0 || i >= tamanho) {
+		fflush(stdout);
+		fprintf(stderr, "%s error: indice %d fora dos limites do vetor '%s' de tamanho %d\n", local, i, nome, tamanho);
+		exit(1);
+	}
+	return i;
+}
+
+/* a divisão inteira por zero mataria o programa com SIGFPE */
+static int upt_divisor(int b, const char *local) {
+	if (b == 0) {
+		fflush(stdout);
+		fprintf(stderr, "%s error: divisão por zero\n", local);
+		exit(1);
+	}
+	return b;
+}
+
+static int upt_divide(int a, int b, const char *local) {
+	return a / upt_divisor(b, local);
+}
+
+static int upt_modulo(int a, int b, const char *local) {
+	return a % upt_divisor(b, local);
+}
+
+static void upt_divide_em(int *alvo, int b, const char *local) {
+	*alvo = upt_divide(*alvo, b, local);
+}
+
+static void upt_modulo_em(int *alvo, int b, const char *local) {
+	*alvo = upt_modulo(*alvo, b, local);
+}
+
+/* embutidos que não existem prontos na math.h */
+static int upt_piso(double x) {
+	return (int)floor(x);
+}
+
+static int upt_teto(double x) {
+	return (int)ceil(x);
+}
+
+static int upt_arredonda(double x) {
+	return (int)round(x);
+}
+
+static double upt_pi(void) {
+	return 3.14159265358979323846;
+}
+
+
+/* sorteia um inteiro entre a e b, incluindo os dois */
+static int upt_aleatorio(int a, int b) {
+	if (a > b) {
+		int t = a;
+		a = b;
+		b = t;
+	}
+	return a + (int)(rand() % ((long long)b - a + 1));
+}
+
+#define UPT_CADEIA_MAX 256
+
+/* cadeias são copiadas por valor, então atribuir, passar como
+   argumento ou retornar uma cadeia nunca compartilha memoria */
+typedef struct {
+	char dados[UPT_CADEIA_MAX];
+} upt_cadeia;
+
+static upt_cadeia upt_cadeia_lit(const char *s) {
+	upt_cadeia c;
+	snprintf(c.dados, UPT_CADEIA_MAX, "%s", s);
+	return c;
+}
+
+static int upt_cadeia_igual(upt_cadeia a, upt_cadeia b) {
+	return strcmp(a.dados, b.dados) == 0;
+}
+
+/* lê uma linha inteira, ignorando os espaços antes dela,
+   o que passar do tamanho maximo é descartado */
+static void upt_cadeia_leia(upt_cadeia *c) {
+	int ch = getchar();
+	int i = 0;
+	while (ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r') {
+		ch = getchar();
+	}
+	if (ch == EOF) {
+		return;
+	}
+	while (ch != EOF && ch != '\n') {
+		if (ch != '\r' && i < UPT_CADEIA_MAX-1) {
+			c->dados[i++] = ch;
+		}
+		ch = getchar();
+	}
+	c->dados[i] = '\0';
+}
 `
 
+// globais são emitidas na ordem do fonte,
+// antes de qualquer procedimento que possa usá-las
+func genGlobals(ctx *context) string {
+	output := ""
+	for _, n := range ctx.M.Root.Leaves {
+		switch n.Kind {
+		case nk.Record:
+			output += genRecord(ctx, n) + "\n"
+		case nk.VarDecl:
+			output += genGlobalVarDecl(ctx, n) + "\n"
+		case nk.Constant:
+			output += genConst(ctx, n) + "\n"
+		}
+	}
+	return output
+}
+
+// registros só podem conter registros declarados antes deles,
+// então a ordem do fonte já é uma ordem valida pro C
+func genRecord(ctx *context, n *mod.Node) string {
+	// record := {id, vardecl...}
+	sy := ctx.M.Global.Symbols[n.Leaves[0].Lexeme.Text]
+	output := "typedef struct {\n"
+	for _, decl := range n.Leaves[1:] {
+		cType := typetoCtype(ctx, decl.Leaves[0].T)
+		for _, id := range decl.Leaves[1:] {
+			cName := localIDtoC(n.Scope, id.Lexeme.Text) + arraySizes(id.T)
+			output += "\t" + cType + " " + cName + ";\n"
+		}
+	}
+	return output + "} " + globalIDtoC(ctx.M, sy) + ";\n"
+}
+
+func genGlobalVarDecl(ctx *context, n *mod.Node) string {
+	// vardecl := {type, id...}
+	cType := typetoCtype(ctx, n.Leaves[0].T)
+	ids := []string{}
+	for _, id := range n.Leaves[1:] {
+		sy := ctx.M.Global.Symbols[id.Lexeme.Text]
+		cName := globalIDtoC(ctx.M, sy)
+		ctx.GlobalMap[sy.Name] = cName
+		ids = append(ids, cName+arraySizes(id.T))
+	}
+	return "static " + cType + " " + strings.Join(ids, ", ") + ";"
+}
+
+func genConst(ctx *context, n *mod.Node) string {
+	// const := {type, id, expr}
+	sy := ctx.M.Global.Symbols[n.Leaves[1].Lexeme.Text]
+	cName := globalIDtoC(ctx.M, sy)
+	ctx.GlobalMap[sy.Name] = cName
+	return fmt.Sprintf("static const %v %v = %v;",
+		typetoCtype(ctx, sy.Type), cName, constToC(sy.Value))
+}
+
+func constToC(v interface{}) string {
+	switch x := v.(type) {
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return realToC(x)
+	case bool:
+		if x {
+			return "true"
+		}
+		return "false"
+	case string:
+		// a cadeia já está escrita como no fonte
+		return "{\"" + x + "\"}"
+	}
+	panic("unreachable")
+}
+
 func forwardDecl(ctx *context) string {
 	output := ""
 	for _, sy := range ctx.M.Global.Symbols {
+		if sy.Kind != sk.Procedure {
+			continue
+		}
 		output += forwardDeclFunc(ctx, sy) + "\n"
 	}
 	return output
@@ -38,11 +219,14 @@ func forwardDecl(ctx *context) string {
 func forwardDeclFunc(ctx *context, sy *mod.Symbol) string {
 	cID := globalIDtoC(ctx.M, sy)
 	ctx.GlobalMap[sy.Name] = cID
-	retType := typetoCtype(sy.Type.Proc.Ret)
+	retType := typetoCtype(ctx, sy.Type.Proc.Ret)
 
 	args := []string{}
 	for _, arg := range sy.Args {
-		cType := typetoCtype(arg.T)
+		cType := typetoCtype(ctx, arg.T)
+		if arg.Ref {
+			cType += "*"
+		}
 		args = append(args, cType)
 	}
 	return fmt.Sprintf("%v %v(%v);", retType, cID, strings.Join(args, ", "))
@@ -50,6 +234,7 @@ func forwardDeclFunc(ctx *context, sy *mod.Symbol) string {
 
 const defaultMain = `
 int main() {
+	srand(time(NULL));
 	return %v();
 }
 `
@@ -61,6 +246,9 @@ func genMain(ctx *context) string {
 func genFunctions(ctx *context) string {
 	output := ""
 	for _, sy := range ctx.M.Global.Symbols {
+		if sy.Kind != sk.Procedure {
+			continue
+		}
 		// precisamos resetar isso pra cada função
 		ctx.LocalMap = map[scopedSymbol]string{}
 		output += genFunc(ctx, sy) + "\n"
@@ -73,12 +261,15 @@ func genFunc(ctx *context, sy *mod.Symbol) string {
 
 	cID := globalIDtoC(ctx.M, sy)
 	ctx.GlobalMap[sy.Name] = cID
-	retType := typetoCtype(sy.Type.Proc.Ret)
+	retType := typetoCtype(ctx, sy.Type.Proc.Ret)
 
 	args := []string{}
 	for _, arg := range sy.Args {
 		cArg := ctx.SetLocal(scope, arg.Name)
-		cType := typetoCtype(arg.T)
+		cType := typetoCtype(ctx, arg.T)
+		if arg.Ref {
+			cType += "*"
+		}
 		out := cType + " " + cArg
 		args = append(args, out)
 	}
@@ -116,13 +307,23 @@ func genCmd(ctx *context, scope *mod.Scope, n *mod.Node) string {
 			return genSe(ctx, scope, n)
 		case lk.Enquanto:
 			return genEnquanto(ctx, scope, n)
+		case lk.Faca:
+			return genFaca(ctx, scope, n)
+		case lk.Escolha:
+			return genEscolha(ctx, scope, n)
 		case lk.Para:
 			return genPara(ctx, scope, n)
 		case lk.Retorne:
 			return genRetorne(ctx, scope, n)
+		case lk.Pare:
+			return genPare(ctx)
+		case lk.Continue:
+			return "continue;"
 		case lk.Assign:
 			return genAtrib(ctx, scope, n) + ";"
 		}
+	case nk.CountedLoop:
+		return genParaDe(ctx, scope, n)
 	case nk.Block:
 		return genBlock(ctx, scope, n)
 	case nk.VarDecl:
@@ -134,12 +335,14 @@ func genCmd(ctx *context, scope *mod.Scope, n *mod.Node) string {
 // caracter -> scanf("%c", &variable)
 // inteiro  -> scanf("%d", &variable)
 // real     -> scanf("%f", &variable)
+// cadeia   -> upt_cadeia_leia(&variable)
 func genLeia(ctx *context, scope *mod.Scope, n *mod.Node) string {
 	arg := n.Leaves[0]
 	format := typeToFormat(arg.T)
-	name := arg.Lexeme.Text
-	_, sc := scope.FindWithScope(name)
-	cName := ctx.FindLocal(sc, name)
+	cName := genExpr(ctx, scope, arg)
+	if T.IsString(arg.T) {
+		return "upt_cadeia_leia(&" + cName + ");"
+	}
 	return "scanf(\"" + format + "\", &" + cName + ");"
 }
 
@@ -151,6 +354,8 @@ func typeToFormat(t *T.Type) string {
 		return "%d"
 	case T.Real:
 		return "%lf"
+	case T.String:
+		return "%s"
 	default:
 		return "%d"
 	}
@@ -163,6 +368,12 @@ func genImprima(ctx *context, scope *mod.Scope, n *mod.Node) string {
 		return "printf(" + arg.Lexeme.Text + ");"
 	}
 	CArg := genExpr(ctx, scope, arg)
+	if T.IsString(arg.T) {
+		CArg += ".dados"
+	}
+	if T.IsLogico(arg.T) {
+		return "printf(\"%s\", " + CArg + " ? \"verdadeiro\" : \"falso\");"
+	}
 	format := typeToFormat(arg.T)
 	return "printf(\"" + format + "\", " + CArg + ");\n"
 }
@@ -180,11 +391,51 @@ func genSe(ctx *context, scope *mod.Scope, n *mod.Node) string {
 		cond, block, senao)
 }
 
+// cada caso termina num 'break', então não existe
+// o fallthrough de C entre os casos
+func genEscolha(ctx *context, scope *mod.Scope, n *mod.Node) string {
+	// escolha := {expr, caso...}
+	var l *loop
+	if len(ctx.Loops) > 0 {
+		l = ctx.Loops[len(ctx.Loops)-1]
+		l.SwitchDepth++
+	}
+	out := "switch (" + genExpr(ctx, scope, n.Leaves[0]) + ")\n" + ctx.indent() + "{\n"
+	for _, c := range n.Leaves[1:] {
+		// caso := {labels, block}
+		// outrocaso := {block}
+		labels := []string{}
+		if c.Lexeme.Kind == lk.Caso {
+			for _, label := range c.Leaves[0].Leaves {
+				labels = append(labels, "case "+constToC(label.Value)+":")
+			}
+		} else {
+			labels = append(labels, "default:")
+		}
+		out += ctx.indent() + strings.Join(labels, " ") + "\n"
+		out += genBlock(ctx, scope, c.Leaves[len(c.Leaves)-1])
+		out += ctx.indent() + "break;\n"
+	}
+	if l != nil {
+		l.SwitchDepth--
+	}
+	return out + ctx.indent() + "}"
+}
+
 func genEnquanto(ctx *context, scope *mod.Scope, n *mod.Node) string {
 	// enquanto := {cond, block}
 	cond := genExpr(ctx, scope, n.Leaves[0])
+	ctx.pushLoop()
 	block := genBlock(ctx, scope, n.Leaves[1])
-	return fmt.Sprintf("while (%v)\n %v", cond, block)
+	return ctx.popLoop(fmt.Sprintf("while (%v)\n %v", cond, block))
+}
+
+func genFaca(ctx *context, scope *mod.Scope, n *mod.Node) string {
+	// faca := {block, cond}
+	ctx.pushLoop()
+	block := genBlock(ctx, scope, n.Leaves[0])
+	cond := genExpr(ctx, scope, n.Leaves[1])
+	return ctx.popLoop(fmt.Sprintf("do\n%v%vwhile (%v);", block, ctx.indent(), cond))
 }
 
 func genPara(ctx *context, scope *mod.Scope, n *mod.Node) string {
@@ -195,47 +446,133 @@ func genPara(ctx *context, scope *mod.Scope, n *mod.Node) string {
 	}
 	cond := genExpr(ctx, scope, n.Leaves[1])
 	second := genAtrib(ctx, scope, n.Leaves[2])
+	ctx.pushLoop()
 	block := genBlock(ctx, scope, n.Leaves[3])
-	return fmt.Sprintf("for (%v; %v; %v)\n%v",
-		first, cond, second, block)
+	return ctx.popLoop(fmt.Sprintf("for (%v; %v; %v)\n%v",
+		first, cond, second, block))
+}
+
+// o fim (e o passo, se não for constante) é guardado numa variavel
+// temporaria pra ser calculado uma unica vez, antes da primeira iteração
+func genParaDe(ctx *context, scope *mod.Scope, n *mod.Node) string {
+	// paraDe := {id, inicio, fim, passo, block}
+	ctx.pushLoop()
+	ate := "upt_ate" + strconv.Itoa(ctx.LabelCounter)
+	passo := "upt_passo" + strconv.Itoa(ctx.LabelCounter)
+	id := genExpr(ctx, scope, n.Leaves[0])
+	first := id + " = " + genExpr(ctx, scope, n.Leaves[1]) +
+		", " + ate + " = " + genExpr(ctx, scope, n.Leaves[2])
+	vars := ate
+
+	var cond, step string
+	if n.Value != nil {
+		k := n.Value.(int64)
+		if k > 0 {
+			cond = id + " <= " + ate
+			step = fmt.Sprintf("%v += %v", id, k)
+		} else {
+			cond = id + " >= " + ate
+			step = fmt.Sprintf("%v -= %v", id, -k)
+		}
+	} else {
+		vars += ", " + passo
+		first += ", " + passo + " = " + genExpr(ctx, scope, n.Leaves[3])
+		cond = fmt.Sprintf("%v > 0 ? %v <= %v : %v >= %v", passo, id, ate, id, ate)
+		step = id + " += " + passo
+	}
+
+	out := "{\n"
+	ctx.IndentLevel++
+	out += ctx.indent() + "int " + vars + ";\n"
+	block := genBlock(ctx, scope, n.Leaves[4])
+	loop := fmt.Sprintf("for (%v; %v; %v)\n%v", first, cond, step, block)
+	out += ctx.indent() + ctx.popLoop(loop)
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	ctx.IndentLevel--
+	return out + ctx.indent() + "}"
+}
+
+func genPare(ctx *context) string {
+	l := ctx.Loops[len(ctx.Loops)-1]
+	if l.SwitchDepth > 0 {
+		l.Used = true
+		return "goto " + l.Label + ";"
+	}
+	return "break;"
 }
 
 func genRetorne(ctx *context, scope *mod.Scope, n *mod.Node) string {
+	if n.Leaves[0] == nil {
+		return "return;"
+	}
 	return "return " + genExpr(ctx, scope, n.Leaves[0]) + ";"
 }
 
 func genAtrib(ctx *context, scope *mod.Scope, n *mod.Node) string {
 	dest := n.Leaves[0]
-	name := dest.Lexeme.Text
 	expr := n.Leaves[1]
-	_, sc := scope.FindWithScope(name)
-	cName := ctx.FindLocal(sc, name)
+	cName := genExpr(ctx, scope, dest)
+	if mod.IsCompound(n) {
+		// o C avalia o alvo de 'v[f()] += 1' uma vez só
+		value := genExpr(ctx, scope, expr.Leaves[1])
+		if isIntDivision(expr) {
+			helper := "upt_divide_em"
+			if expr.Lexeme.Kind == lk.Remainder {
+				helper = "upt_modulo_em"
+			}
+			return fmt.Sprintf("%v(&%v, %v, %v)", helper, cName, value, place(ctx, expr))
+		}
+		op := opToC(expr.Lexeme.Kind)
+		return cName + " " + op + "= " + value
+	}
 	return cName + " = " + genExpr(ctx, scope, expr)
 }
 
 func genVarDecl(ctx *context, scope *mod.Scope, n *mod.Node) string {
 	t := n.Leaves[0].T
-	cType := typetoCtype(t)
+	cType := typetoCtype(ctx, t)
 	ids := []string{}
 	for _, id := range n.Leaves[1:] {
 		name := id.Lexeme.Text
-		cName := ctx.SetLocal(scope, name)
+		cName := ctx.SetLocal(scope, name) + arraySizes(id.T)
+		if T.IsString(t) || T.IsRecord(t) {
+			// uma cadeia sem o '\0' não é segura de imprimir,
+			// e registros podem conter cadeias
+			cName += " = {0}"
+		}
 		ids = append(ids, cName)
 	}
 	return cType + " " + strings.Join(ids, ", ") + ";"
 }
 
+func arraySizes(t *T.Type) string {
+	out := ""
+	for ; T.IsArray(t); t = t.Array.Elem {
+		out += "[" + strconv.FormatInt(t.Array.Len, 10) + "]"
+	}
+	return out
+}
+
 // geramos todas as expressões com parentesis pra ter certeza de que
 // a ordem de precedencia da linguagem fonte é respeitada
 func genExpr(ctx *context, scope *mod.Scope, n *mod.Node) string {
 	switch n.Kind {
 	case nk.Terminal:
 		switch n.Lexeme.Kind {
-		case lk.Ou, lk.E, lk.Equals, lk.Different,
+		case lk.Equals, lk.Different:
+			if T.IsString(n.Leaves[0].T) {
+				return genStringEquality(ctx, scope, n)
+			}
+			return genBinExpr(ctx, scope, n)
+		case lk.Ou, lk.E,
 			lk.Greater, lk.GreaterOrEquals, lk.Less, lk.LessOrEquals,
 			lk.Plus, lk.Star, lk.Division,
 			lk.Remainder:
 			return genBinExpr(ctx, scope, n)
+		case lk.Caret:
+			return genPotencia(ctx, scope, n)
 		case lk.Nao:
 			return "(!" + genExpr(ctx, scope, n.Leaves[0]) + ")"
 		case lk.Minus:
@@ -243,50 +580,176 @@ func genExpr(ctx *context, scope *mod.Scope, n *mod.Node) string {
 				return "(-" + genExpr(ctx, scope, n.Leaves[0]) + ")"
 			}
 			return genBinExpr(ctx, scope, n)
-		case lk.IntLit, lk.RealLit, lk.CharLit:
+		case lk.IntLit, lk.RealLit, lk.CharLit, lk.Verdadeiro, lk.Falso:
 			return litToC(n)
+		case lk.StringLit:
+			// a gente mantem as aspas no token da string
+			return "upt_cadeia_lit(" + n.Lexeme.Text + ")"
 		case lk.Ident:
 			name := n.Lexeme.Text
 			sy, sc := scope.FindWithScope(name)
 			switch sy.Kind {
 			case sk.Local, sk.Argument:
+				if sy.Ref {
+					// argumentos por referencia são ponteiros
+					return "(*" + ctx.FindLocal(sc, name) + ")"
+				}
 				return ctx.FindLocal(sc, name)
-			case sk.Procedure:
+			case sk.Procedure, sk.Global, sk.Constant:
+				if sy.Builtin {
+					return builtinToC[name]
+				}
 				return ctx.GlobalMap[name]
 			}
 			panic("unreachable")
 		}
 	case nk.Call:
 		return genCall(ctx, scope, n)
+	case nk.Index:
+		return genIndex(ctx, scope, n)
+	case nk.Field:
+		// field := {registro, id}
+		reg := n.Leaves[0]
+		return genExpr(ctx, scope, reg) + "." + fieldIDtoC(ctx, reg.T, n.Leaves[1].Lexeme.Text)
 	}
 	fmt.Println(n)
 	panic("unreachable")
 }
 
+// os embutidos são funções da math.h ou do cabeçalho padrão,
+// o C converte os argumentos inteiros pra double sozinho
+var builtinToC = map[string]string{
+	"raiz":      "sqrt",
+	"expo":      "pow",
+	"abs":       "fabs",
+	"piso":      "upt_piso",
+	"teto":      "upt_teto",
+	"arredonda": "upt_arredonda",
+	"sen":       "sin",
+	"cos":       "cos",
+	"tan":       "tan",
+	"log":       "log10",
+	"ln":        "log",
+	"pi":        "upt_pi",
+	"max":       "fmax",
+	"min":       "fmin",
+	"quociente": "upt_divide",
+	"resto":     "upt_modulo",
+	"aleatorio": "upt_aleatorio",
+}
+
+// embutidos que recebem o lugar da chamada, como upt_divide
+var divisionBuiltins = map[string]bool{
+	"quociente": true,
+	"resto":     true,
+}
+
+// pow sempre retorna double, então o resultado é convertido
+// de volta quando os dois operandos são inteiros
+func genPotencia(ctx *context, scope *mod.Scope, n *mod.Node) string {
+	out := fmt.Sprintf("pow(%v, %v)",
+		genExpr(ctx, scope, n.Leaves[0]),
+		genExpr(ctx, scope, n.Leaves[1]))
+	if n.T.Basic == T.Real {
+		return out
+	}
+	return "((" + typetoCtype(ctx, n.T) + ")" + out + ")"
+}
+
 func genCall(ctx *context, scope *mod.Scope, n *mod.Node) string {
 	proc := n.Leaves[0]
 	cProc := genExpr(ctx, scope, proc)
 
+	sy := scope.Find(proc.Lexeme.Text)
 	cArgs := []string{}
 	args := n.Leaves[1]
-	for _, expr := range args.Leaves {
+	for i, expr := range args.Leaves {
 		carg := genExpr(ctx, scope, expr)
+		if sy.Args[i].Ref {
+			carg = "&" + carg
+		}
 		cArgs = append(cArgs, carg)
 	}
+	if sy.Builtin && divisionBuiltins[sy.Name] {
+		cArgs = append(cArgs, place(ctx, n))
+	}
 
 	return fmt.Sprintf("%v(%v)", cProc, strings.Join(cArgs, ", "))
 }
 
+// todo acesso passa por upt_indice, que aborta o programa
+// com uma mensagem se o indice estiver fora dos limites
+func genIndex(ctx *context, scope *mod.Scope, n *mod.Node) string {
+	// index := {vetor, expr}
+	vetor := n.Leaves[0]
+	idx := n.Leaves[1]
+	return fmt.Sprintf("%v[upt_indice(%v, %v, %v, %v)]",
+		genExpr(ctx, scope, vetor),
+		genExpr(ctx, scope, idx),
+		vetor.T.Array.Len,
+		place(ctx, n),
+		strconv.Quote(vetorName(vetor)))
+}
+
+func vetorName(n *mod.Node) string {
+	switch n.Kind {
+	case nk.Index:
+		return vetorName(n.Leaves[0])
+	case nk.Field:
+		return vetorName(n.Leaves[0]) + "." + n.Leaves[1].Lexeme.Text
+	case nk.Call:
+		return vetorName(n.Leaves[0]) + "(...)"
+	}
+	return n.Lexeme.Text
+}
+
+func genStringEquality(ctx *context, scope *mod.Scope, n *mod.Node) string {
+	out := fmt.Sprintf("upt_cadeia_igual(%v, %v)",
+		genExpr(ctx, scope, n.Leaves[0]),
+		genExpr(ctx, scope, n.Leaves[1]))
+	if n.Lexeme.Kind == lk.Different {
+		return "(!" + out + ")"
+	}
+	return out
+}
+
 func genBinExpr(ctx *context, scope *mod.Scope, n *mod.Node) string {
 	op := opToC(n.Lexeme.Kind)
 	left := n.Leaves[0]
 	right := n.Leaves[1]
+	if isIntDivision(n) {
+		helper := "upt_divide"
+		if n.Lexeme.Kind == lk.Remainder {
+			helper = "upt_modulo"
+		}
+		return fmt.Sprintf("%v(%v, %v, %v)",
+			helper,
+			genExpr(ctx, scope, left),
+			genExpr(ctx, scope, right),
+			place(ctx, n))
+	}
 	return fmt.Sprintf("(%v %v %v)",
 		genExpr(ctx, scope, left),
 		op,
 		genExpr(ctx, scope, right))
 }
 
+// a divisão inteira passa por upt_divide ou upt_modulo, que abortam
+// o programa com uma mensagem se o divisor for zero
+func isIntDivision(n *mod.Node) bool {
+	switch n.Lexeme.Kind {
+	case lk.Division, lk.Remainder:
+		return T.T_Inteiro.Equals(n.T)
+	}
+	return false
+}
+
+// place é o lugar do nó no arquivo, como literal do C,
+// pras mensagens de erro em tempo de execução
+func place(ctx *context, n *mod.Node) string {
+	return strconv.Quote(mod.Place(ctx.M, n).String())
+}
+
 func opToC(kind lk.LexKind) string {
 	switch kind {
 	case lk.Ou:
@@ -325,13 +788,25 @@ func litToC(n *mod.Node) string {
 	case lk.CharLit, lk.IntLit:
 		v := n.Lexeme.Value.(int64)
 		return fmt.Sprintf("%v", v)
+	case lk.Verdadeiro:
+		return "true"
+	case lk.Falso:
+		return "false"
 	case lk.RealLit:
-		v := n.Lexeme.Value.(float64)
-		return fmt.Sprintf("%v", v)
+		return realToC(n.Lexeme.Value.(float64))
 	}
 	panic("unreachable")
 }
 
+// sem o ponto, o C trataria o literal como inteiro
+func realToC(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
 type scopedSymbol struct {
 	ScopeID int
 	Name    string
@@ -342,6 +817,38 @@ type context struct {
 	GlobalMap   map[string]string
 	LocalMap    map[scopedSymbol]string
 	IndentLevel int
+
+	// laços que envolvem o comando atual, o ultimo é o mais interno
+	Loops        []*loop
+	LabelCounter int
+}
+
+// um 'pare' dentro de um 'escolha' não pode virar 'break',
+// já que em C ele sairia do switch, então ele vira um goto
+// pra um rotulo logo depois do laço
+type loop struct {
+	SwitchDepth int
+	Label       string
+	Used        bool
+}
+
+func (this *context) pushLoop() {
+	this.LabelCounter++
+	label := "upt_fim" + strconv.Itoa(this.LabelCounter)
+	this.Loops = append(this.Loops, &loop{Label: label})
+}
+
+// popLoop adiciona o rotulo depois do laço, se algum 'pare' precisar dele
+func (this *context) popLoop(out string) string {
+	l := this.Loops[len(this.Loops)-1]
+	this.Loops = this.Loops[:len(this.Loops)-1]
+	if !l.Used {
+		return out
+	}
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	return out + this.indent() + l.Label + ": ;"
 }
 
 func newCtx(M *mod.Module) *context {
@@ -401,10 +908,21 @@ func globalIDtoC(mod *mod.Module, sy *mod.Symbol) string {
 	return mod.Name + "_" + sy.Name
 }
 
-func typetoCtype(t *T.Type) string {
+// os campos seguem a mesma regra dos locais,
+// usando o escopo de campos do registro
+func fieldIDtoC(ctx *context, t *T.Type, name string) string {
+	sy := ctx.M.Global.Symbols[t.Record.Name]
+	return localIDtoC(sy.N.Scope, name)
+}
+
+func typetoCtype(ctx *context, t *T.Type) string {
 	if T.IsProc(t) {
 		panic("unimplemented")
 	}
+	if T.IsRecord(t) {
+		sy := ctx.M.Global.Symbols[t.Record.Name]
+		return globalIDtoC(ctx.M, sy)
+	}
 	switch t.Basic {
 	case T.Caractere:
 		return "char"
@@ -415,7 +933,9 @@ func typetoCtype(t *T.Type) string {
 	case T.Void:
 		return "void"
 	case T.String:
-		return "char *" // talvez não funcione
+		return "upt_cadeia"
+	case T.Logico:
+		return "bool"
 	}
 	panic("unreachable")
 }
@@ -2,7 +2,8 @@ package asciicolors
 
 type Color = string
 
-const (
+// são variaveis para que Disable possa apagar todas
+var (
 	Bold = "\u001b[1m"
 
 	Black   = "\u001b[30m"
@@ -25,6 +26,21 @@ const (
 	BackgroundWhite   = "\u001b[47m"
 )
 
+// Disable remove as cores de tudo que for gerado depois,
+// usado quando a saida não é um terminal
+func Disable() {
+	Bold = ""
+
+	Black, Red, Green, Yellow = "", "", "", ""
+	Blue, Magenta, Cyan, White = "", "", "", ""
+	Reset = ""
+
+	BackgroundBlack, BackgroundRed = "", ""
+	BackgroundGreen, BackgroundYellow = "", ""
+	BackgroundBlue, BackgroundMagenta = "", ""
+	BackgroundCyan, BackgroundWhite = "", ""
+}
+
 func MakeBlue(s string) string {
 	return Blue + s + Reset
 }
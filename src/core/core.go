@@ -3,6 +3,7 @@ package core
 import (
 	"fmt"
 	"io/ioutil"
+	"sort"
 	"strconv"
 	colors "upt/core/asciicolors"
 	et "upt/core/errorkind"
@@ -121,6 +122,19 @@ type Error struct {
 	Severity sv.Severity
 	Message  string
 	Location *Location
+
+	// sugestão de correção, como um nome parecido
+	Hint string
+
+	// outros lugares do codigo que ajudam a entender o erro
+	Notes []*Note
+}
+
+// Note aponta um lugar relacionado a um erro,
+// como a declaração da variavel envolvida
+type Note struct {
+	Message  string
+	Location *Location
 }
 
 func (this *Error) String() string {
@@ -129,7 +143,17 @@ func (this *Error) String() string {
 		this.Severity.String() +
 		": " + this.Message
 	if source != "" {
-		return message + "\n" + source
+		message += "\n" + source
+	}
+	if this.Hint != "" {
+		message += "\n    dica: " + this.Hint
+	}
+	for _, note := range this.Notes {
+		message += "\n" + note.Location.String() + " nota: " + note.Message
+		source = note.Location.Source()
+		if source != "" {
+			message += "\n" + source
+		}
 	}
 	return message
 }
@@ -138,6 +162,41 @@ func (this *Error) ErrCode() string {
 	return this.Code.String()
 }
 
+// ErrorList acumula os erros de um estagio, para que todos
+// os problemas do arquivo possam ser mostrados de uma vez
+type ErrorList []*Error
+
+// Sort ordena os erros pela posição no arquivo,
+// erros sem posição (como os de arquivo) vem primeiro
+func (this ErrorList) Sort() {
+	sort.SliceStable(this, func(i, j int) bool {
+		return this[i].Before(this[j])
+	})
+}
+
+// First retorna o erro que aparece primeiro no arquivo,
+// ou nil se a lista estiver vazia
+func (this ErrorList) First() *Error {
+	var first *Error
+	for _, err := range this {
+		if first == nil || err.Before(first) {
+			first = err
+		}
+	}
+	return first
+}
+
+func (this *Error) Before(other *Error) bool {
+	a, b := this.Location, other.Location
+	if a == nil || a.Range == nil {
+		return b != nil && b.Range != nil
+	}
+	if b == nil || b.Range == nil {
+		return false
+	}
+	return a.Range.Begin.LessThan(b.Range.Begin)
+}
+
 func ProcessFileError(e error) *Error {
 	return &Error{
 		Code:     et.FileError,
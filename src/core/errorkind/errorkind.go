@@ -30,6 +30,26 @@ const (
 	NoEntryPoint
 	WrongEntryType
 	ArgNotAssignable
+	RuntimeError
+	MissingReturn
+	InvalidArraySize
+	WrongIndexCount
+	InvalidConstant
+	NotAType
+	FieldNotFound
+	InvalidReturn
+	VoidAsValue
+	DuplicateCase
+	OutsideLoop
+	InvalidStep
+	UninitializedVar
+
+	// warnings
+	UnreachableCode
+	UnusedLocal
+	UnusedArgument
+	UnusedProcedure
+	ShadowedName
 )
 
 var ErrorCodeMap = map[ErrorKind]string{
@@ -50,4 +70,23 @@ var ErrorCodeMap = map[ErrorKind]string{
 	NoEntryPoint:          "E015",
 	WrongEntryType:        "E016",
 	ArgNotAssignable:      "E017",
+	RuntimeError:          "E018",
+	MissingReturn:         "E019",
+	InvalidArraySize:      "E020",
+	WrongIndexCount:       "E021",
+	InvalidConstant:       "E022",
+	NotAType:              "E023",
+	FieldNotFound:         "E024",
+	InvalidReturn:         "E025",
+	VoidAsValue:           "E026",
+	DuplicateCase:         "E027",
+	OutsideLoop:           "E028",
+	InvalidStep:           "E029",
+	UninitializedVar:      "E030",
+
+	UnreachableCode: "W001",
+	UnusedLocal:     "W002",
+	UnusedArgument:  "W003",
+	UnusedProcedure: "W004",
+	ShadowedName:    "W005",
 }
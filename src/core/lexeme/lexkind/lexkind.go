@@ -27,24 +27,53 @@ const (
 	Star
 	Division
 	Remainder
+	Caret
 
 	Comma
+	Colon
+	Dot
 	Semicolon
 	LeftParen
 	RightParen
 	LeftBrace
 	RightBrace
+	LeftBracket
+	RightBracket
+	Ampersand
 
 	Assign
+	PlusAssign
+	MinusAssign
+	StarAssign
+	DivisionAssign
+	RemainderAssign
+	Increment
+	Decrement
 
 	Retorne
 	Para
+	De
+	Ate
+	Passo
 	Enquanto
+	Faca
 	Se
 	Senao
+	Escolha
+	Caso
+	Outrocaso
+	Pare
+	Continue
 	Real
 	Inteiro
 	Caractere
+	Cadeia
+	Logico
+	Vazio
+	Verdadeiro
+	Falso
+	Constante
+	Registro
 	Imprima
 	Leia
 	Ou
@@ -73,8 +102,12 @@ var mapToString = map[LexKind]string{
 	Star:      "*",
 	Division:  "/",
 	Remainder: "%",
+	Caret:     "^",
 
 	Comma:     ",",
+	Colon:     ":",
+	Dot:       ".",
+	Ampersand: "&",
 	Semicolon: ";",
 
 	LeftParen:  "(",
@@ -82,21 +115,47 @@ var mapToString = map[LexKind]string{
 	LeftBrace:  "{",
 	RightBrace: "}",
 
-	Assign: "=",
-
-	Retorne:   "retorne",
-	Para:      "para",
-	Enquanto:  "enquanto",
-	Se:        "se",
-	Senao:     "senao",
-	Real:      "real",
-	Inteiro:   "inteiro",
-	Caractere: "caractere",
-	Imprima:   "imprima",
-	Leia:      "leia",
-	Ou:        "ou",
-	E:         "e",
-	Nao:       "nao",
+	LeftBracket:  "[",
+	RightBracket: "]",
+
+	Assign:          "=",
+	PlusAssign:      "+=",
+	MinusAssign:     "-=",
+	StarAssign:      "*=",
+	DivisionAssign:  "/=",
+	RemainderAssign: "%=",
+	Increment:       "++",
+	Decrement:       "--",
+
+	Retorne:    "retorne",
+	Para:       "para",
+	De:         "de",
+	Ate:        "ate",
+	Passo:      "passo",
+	Enquanto:   "enquanto",
+	Faca:       "faca",
+	Se:         "se",
+	Senao:      "senao",
+	Escolha:    "escolha",
+	Caso:       "caso",
+	Outrocaso:  "outrocaso",
+	Pare:       "pare",
+	Continue:   "continue",
+	Real:       "real",
+	Inteiro:    "inteiro",
+	Caractere:  "caractere",
+	Cadeia:     "cadeia",
+	Logico:     "logico",
+	Verdadeiro: "verdadeiro",
+	Falso:      "falso",
+	Constante:  "constante",
+	Registro:   "registro",
+	Vazio:      "vazio",
+	Imprima:    "imprima",
+	Leia:       "leia",
+	Ou:         "ou",
+	E:          "e",
+	Nao:        "nao",
 
 	EOF: "EOF",
 }
@@ -24,12 +24,23 @@ type Node struct {
 
 	// only for scoped nodes
 	Scope *Scope
+
+	// só para rotulos de 'caso' e o passo constante de 'para ... de',
+	// calculado pelo typechecker
+	Value interface{}
 }
 
 func (this *Node) String() string {
 	return ast(this, 0)
 }
 
+// IsCompound diz se a atribuição veio de um 'x += e' ou 'x++', que o
+// parser transforma em 'x = x + e' mantendo o texto original.
+// O alvo aparece duas vezes na arvore, mas deve ser avaliado uma vez só
+func IsCompound(n *Node) bool {
+	return n.Lexeme.Text != "="
+}
+
 func (this *Node) AddLeaf(other *Node) {
 	if this.Leaves == nil {
 		this.Leaves = []*Node{other}
@@ -85,9 +96,44 @@ func indent(n int) string {
 	return output
 }
 
+// Universe contem os procedimentos embutidos, que podem
+// ser usados (ou redefinidos) por qualquer modulo
 var Universe *Scope = &Scope{
-	Parent:  nil,
-	Symbols: map[string]*Symbol{},
+	Parent: nil,
+	Symbols: map[string]*Symbol{
+		"raiz":      newBuiltin("raiz", T.T_RealToReal),
+		"expo":      newBuiltin("expo", T.T_RealsToReal),
+		"abs":       newBuiltin("abs", T.T_RealToReal),
+		"piso":      newBuiltin("piso", T.T_RealToInteiro),
+		"teto":      newBuiltin("teto", T.T_RealToInteiro),
+		"arredonda": newBuiltin("arredonda", T.T_RealToInteiro),
+		"sen":       newBuiltin("sen", T.T_RealToReal),
+		"cos":       newBuiltin("cos", T.T_RealToReal),
+		"tan":       newBuiltin("tan", T.T_RealToReal),
+		"log":       newBuiltin("log", T.T_RealToReal),
+		"ln":        newBuiltin("ln", T.T_RealToReal),
+		"pi":        newBuiltin("pi", T.T_Constante),
+		"max":       newBuiltin("max", T.T_RealsToReal),
+		"min":       newBuiltin("min", T.T_RealsToReal),
+		"quociente": newBuiltin("quociente", T.T_InteirosToInteiro),
+		"resto":     newBuiltin("resto", T.T_InteirosToInteiro),
+		"aleatorio": newBuiltin("aleatorio", T.T_InteirosToInteiro),
+	},
+}
+
+// embutidos não tem nó na arvore, então N é sempre nil
+func newBuiltin(name string, t *T.Type) *Symbol {
+	args := []Arg{}
+	for i, argT := range t.Proc.Args {
+		args = append(args, Arg{T: argT, Pos: i})
+	}
+	return &Symbol{
+		Kind:    sk.Procedure,
+		Name:    name,
+		Type:    t,
+		Builtin: true,
+		Args:    args,
+	}
 }
 
 func Place(M *Module, n *Node) *Location {
@@ -107,12 +153,33 @@ func NewError(M *Module, t ek.ErrorKind, n *Node, message string) *Error {
 	}
 }
 
+func NewWarning(M *Module, t ek.ErrorKind, n *Node, message string) *Error {
+	loc := Place(M, n)
+	return &Error{
+		Code:     t,
+		Severity: sv.Warning,
+		Location: loc,
+		Message:  message,
+	}
+}
+
 type Module struct {
 	FullPath string
 	Name     string
 	Root     *Node
 
 	Global *Scope
+
+	// avisos não interrompem a compilação
+	Warnings []*Error
+
+	// erros encontrados por um estagio, que continua até o fim
+	// para achar o resto dos erros antes de parar a compilação
+	Errors ErrorList
+
+	// procedimentos com erros de resolução, o typechecker
+	// ainda checa o resto do modulo sem eles
+	Unresolved map[*Symbol]bool
 }
 
 func (this *Module) String() string {
@@ -179,6 +246,23 @@ func (this *Scope) FindWithScope(name string) (*Symbol, *Scope) {
 	return this.Parent.FindWithScope(name)
 }
 
+// Declared guarda as locais cuja declaração já foi vista, para
+// as etapas que percorrem um procedimento depois da resolução,
+// quando todas as locais do bloco já estão no escopo
+type Declared map[*Symbol]bool
+
+// Find procura o nome como a resolução procurou:
+// uma local só é visivel depois da sua declaração
+func (this Declared) Find(scope *Scope, name string) *Symbol {
+	for s := scope; s != nil; s = s.Parent {
+		sy, ok := s.Symbols[name]
+		if ok && (sy.Kind != sk.Local || this[sy]) {
+			return sy
+		}
+	}
+	return nil
+}
+
 func (this *Scope) Add(name string, sy *Symbol) {
 	_, ok := this.Symbols[name]
 	if ok {
@@ -197,12 +281,26 @@ type Symbol struct {
 	Builtin bool
 
 	Args []Arg // mais facil de traduzir
+
+	// só para argumentos passados por referencia
+	Ref bool
+
+	// só para constantes, calculado pelo typechecker
+	Value interface{} // int64 | float64 | string | bool
 }
 
 func (this *Symbol) String() string {
 	switch this.Kind {
 	case sk.Procedure:
 		return "proc " + this.Name
+	case sk.Global:
+		return "global " + this.Name
+	case sk.Constant:
+		return "const " + this.Name
+	case sk.Type:
+		return "type " + this.Name
+	case sk.Field:
+		return "field " + this.Name
 	case sk.Local:
 		return "local " + this.Name
 	case sk.Argument:
@@ -217,4 +315,5 @@ type Arg struct {
 	N    *Node
 	Name string
 	Pos  int
+	Ref  bool // o argumento é um apelido pra variavel de quem chamou
 }
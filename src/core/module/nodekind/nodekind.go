@@ -28,6 +28,16 @@ func (this NodeKind) String() string {
 		return "expression list"
 	case VarDecl:
 		return "variable list"
+	case Index:
+		return "index"
+	case Constant:
+		return "constant"
+	case Record:
+		return "record"
+	case Field:
+		return "field"
+	case CountedLoop:
+		return "counted loop"
 	}
 	return strconv.FormatInt(int64(this), 10)
 }
@@ -45,4 +55,9 @@ const (
 	Block
 	ExpressionList
 	VarDecl
+	Index
+	Constant
+	Record
+	Field
+	CountedLoop
 )
@@ -5,6 +5,11 @@ type SymbolKind int
 const (
 	InvalidSymbolKind SymbolKind = iota
 	Procedure
+	Global
+	Constant
+	Type
+	// campos de um registro
+	Field
 	// Local scope
 	Argument
 	Local
@@ -1,12 +1,15 @@
 package types
 
 import (
+	"strconv"
 	"strings"
 )
 
 type Type struct {
-	Basic BasicType
-	Proc  *ProcType
+	Basic  BasicType
+	Proc   *ProcType
+	Array  *ArrayType
+	Record *RecordType
 }
 
 func (t *Type) String() string {
@@ -21,13 +24,21 @@ func (t *Type) String() string {
 	case Caractere:
 		return "caractere"
 	case Void:
-		return "void"
+		return "vazio"
 	case String:
-		return "string"
+		return "cadeia"
+	case Logico:
+		return "logico"
 	}
 	if t.Proc != nil {
 		return t.Proc.String()
 	}
+	if t.Array != nil {
+		return t.Array.String()
+	}
+	if t.Record != nil {
+		return t.Record.String()
+	}
 	return "invalid type"
 }
 
@@ -42,6 +53,18 @@ func (this *Type) Equals(other *Type) bool {
 	if this.Proc != nil && other.Proc != nil {
 		return this.Proc.Equals(other.Proc)
 	}
+	if this.Array != nil && other.Array != nil {
+		return this.Array.Equals(other.Array)
+	}
+	if this.Record != nil && other.Record != nil {
+		return this.Record.Equals(other.Record)
+	}
+	if this.Proc != nil || other.Proc != nil {
+		return false
+	}
+	if this.Array != nil || other.Array != nil {
+		return false
+	}
 	panic("cannot compare " + this.String() + " with " + other.String())
 }
 
@@ -62,6 +85,26 @@ var ConversionTable = [][]BasicType{
 		Inteiro:   Inteiro,
 		Caractere: Caractere,
 	},
+	// cadeias e logicos só se combinam entre si, em '==' e '!='
+	String: {
+		String: String,
+	},
+	Logico: {
+		Logico: Logico,
+	},
+}
+
+// Assignable diz se um valor do tipo 'from' pode ser guardado
+// numa variavel do tipo 'to'. Registros só podem ser atribuidos
+// a registros do mesmo tipo, e vetores não podem ser atribuidos.
+func Assignable(to, from *Type) bool {
+	if IsRecord(to) || IsRecord(from) {
+		return to.Equals(from)
+	}
+	if !IsValue(to) || !IsValue(from) {
+		return false
+	}
+	return AssignmentTable[to.Basic][from.Basic]
 }
 
 // usage: IsValid = AssignmentTable[LeftSideType][RightSideType]
@@ -70,16 +113,36 @@ var AssignmentTable = [][]bool{
 		Real:      true,
 		Inteiro:   true,
 		Caractere: true,
+		String:    false,
+		Logico:    false,
 	},
 	Inteiro: {
 		Real:      false,
 		Inteiro:   true,
 		Caractere: true,
+		String:    false,
+		Logico:    false,
 	},
 	Caractere: {
 		Real:      false,
 		Inteiro:   false,
 		Caractere: true,
+		String:    false,
+		Logico:    false,
+	},
+	String: {
+		Real:      false,
+		Inteiro:   false,
+		Caractere: false,
+		String:    true,
+		Logico:    false,
+	},
+	Logico: {
+		Real:      false,
+		Inteiro:   false,
+		Caractere: false,
+		String:    false,
+		Logico:    true,
 	},
 }
 
@@ -92,6 +155,7 @@ const (
 	Inteiro
 	Caractere
 	String
+	Logico
 
 	Void
 )
@@ -124,6 +188,49 @@ func (this *ProcType) Equals(other *ProcType) bool {
 	return true
 }
 
+type ArrayType struct {
+	Elem *Type
+	Len  int64
+}
+
+func (this *ArrayType) String() string {
+	return this.Elem.String() + "[" + strconv.FormatInt(this.Len, 10) + "]"
+}
+
+func (this *ArrayType) Equals(other *ArrayType) bool {
+	return this.Len == other.Len && this.Elem.Equals(other.Elem)
+}
+
+// RecordType é identificado pelo nome,
+// dois registros com os mesmos campos ainda são tipos diferentes
+type RecordType struct {
+	Name   string
+	Fields []*Field
+}
+
+type Field struct {
+	Name string
+	T    *Type
+}
+
+func (this *RecordType) String() string {
+	return this.Name
+}
+
+func (this *RecordType) Equals(other *RecordType) bool {
+	return this == other
+}
+
+// Field retorna nil se o campo não existe
+func (this *RecordType) Field(name string) *Field {
+	for _, f := range this.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
 func IsBasic(tt *Type) bool {
 	return tt.Basic != InvalidBasicType
 }
@@ -132,6 +239,48 @@ func IsProc(tt *Type) bool {
 	return tt.Proc != nil
 }
 
+func IsArray(tt *Type) bool {
+	return tt.Array != nil
+}
+
+func IsRecord(tt *Type) bool {
+	return tt.Record != nil
+}
+
+// IsScalar diz se o tipo pode ser usado em operações aritmeticas
+// e lido ou impresso diretamente
+func IsScalar(tt *Type) bool {
+	switch tt.Basic {
+	case Real, Inteiro, Caractere:
+		return true
+	}
+	return false
+}
+
+// IsValue diz se o tipo pode ser impresso e atribuido
+func IsValue(tt *Type) bool {
+	return IsScalar(tt) || IsString(tt) || IsLogico(tt)
+}
+
+func IsLogico(tt *Type) bool {
+	return tt.Basic == Logico
+}
+
+func IsString(tt *Type) bool {
+	return tt.Basic == String
+}
+
+// Dimensions retorna o número de indices necessarios
+// pra chegar num elemento escalar do vetor
+func Dimensions(tt *Type) int {
+	dims := 0
+	for tt.Array != nil {
+		dims++
+		tt = tt.Array.Elem
+	}
+	return dims
+}
+
 func IsVoid(tt *Type) bool {
 	return tt.Basic == Void
 }
@@ -141,11 +290,33 @@ var T_Real = &Type{Basic: Real}
 var T_Void = &Type{Basic: Void}
 var T_Caractere = &Type{Basic: Caractere}
 var T_String = &Type{Basic: String}
+var T_Logico = &Type{Basic: Logico}
 
-var T_Sqrt = NewProcType([]*Type{T_Real}, T_Real)
-var T_Pow = NewProcType([]*Type{T_Real, T_Real}, T_Real)
+// assinaturas dos procedimentos embutidos
+var T_RealToReal = NewProcType([]*Type{T_Real}, T_Real)
+var T_RealsToReal = NewProcType([]*Type{T_Real, T_Real}, T_Real)
+var T_RealToInteiro = NewProcType([]*Type{T_Real}, T_Inteiro)
+var T_InteirosToInteiro = NewProcType([]*Type{T_Inteiro, T_Inteiro}, T_Inteiro)
+var T_Constante = NewProcType([]*Type{}, T_Real)
 var T_Entrada = NewProcType([]*Type{}, T_Inteiro)
 
+func NewArrayType(elem *Type, length int64) *Type {
+	return &Type{
+		Array: &ArrayType{
+			Elem: elem,
+			Len:  length,
+		},
+	}
+}
+
+func NewRecordType(name string) *Type {
+	return &Type{
+		Record: &RecordType{
+			Name: name,
+		},
+	}
+}
+
 func NewProcType(args []*Type, ret *Type) *Type {
 	return &Type{
 		Proc: &ProcType{
@@ -0,0 +1,253 @@
+package debugger
+
+import (
+	. "upt/core"
+	mod "upt/core/module"
+	T "upt/core/types"
+	"upt/interpreter"
+
+	ek "upt/core/errorkind"
+	nk "upt/core/module/nodekind"
+	sv "upt/core/severity"
+
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// o depurador executa o programa no interpretador e
+// pausa antes dos comandos, esperando instruções do usuario.
+// As linhas são mostradas começando em 1, como nos editores.
+
+type mode int
+
+const (
+	stepInto mode = iota // pausa no proximo comando
+	stepOver             // pausa no proximo comando do mesmo procedimento
+	stepOut              // pausa quando o procedimento atual retornar
+	running              // pausa só nos pontos de parada
+)
+
+type debugger struct {
+	M   *mod.Module
+	In  *bufio.Reader
+	Out io.Writer
+
+	Lines       []string
+	Breakpoints map[int]bool
+
+	Mode  mode
+	Depth int // profundidade da pilha quando o comando foi dado
+
+	// ultimo comando visto, evita parar duas vezes na mesma linha
+	LastLine  int
+	LastDepth int
+}
+
+var errQuit = &Error{
+	Code:     ek.RuntimeError,
+	Severity: sv.Error,
+	Message:  "execução interrompida pelo depurador",
+}
+
+const help = `comandos:
+  p, parar <linha>      adiciona um ponto de parada na linha
+  r, remover <linha>    remove o ponto de parada da linha
+  c, continuar          executa até o proximo ponto de parada
+  s, passo              executa o proximo comando, entrando em procedimentos
+  n, proximo            executa o proximo comando, sem entrar em procedimentos
+  f, finalizar          executa até o procedimento atual retornar
+  v, ver <nome>         mostra o valor de uma variavel
+  l, locais             mostra todas as variaveis visiveis
+  t, pilha              mostra a pilha de chamadas
+  q, sair               interrompe o programa
+  a, ajuda              mostra essa mensagem
+`
+
+// Debug executa o programa sob o depurador, os comandos do depurador
+// e a entrada do programa são lidos de 'in'
+func Debug(M *mod.Module, in io.Reader, out io.Writer) (int, *Error) {
+	text, e := ioutil.ReadFile(M.FullPath)
+	if e != nil {
+		return 1, ProcessFileError(e)
+	}
+	it := interpreter.NewInterpreter(M, in, out)
+	d := &debugger{
+		M:           M,
+		In:          it.In, // compartilhado com o 'leia' do programa
+		Out:         out,
+		Lines:       strings.Split(string(text), "\n"),
+		Breakpoints: map[int]bool{},
+		Mode:        stepInto,
+		LastLine:    -1,
+	}
+	it.Hook = d.hook
+	fmt.Fprint(out, "depurando "+M.Name+", digite 'ajuda' para ver os comandos\n")
+	code, err := it.Run()
+	if err == errQuit {
+		return 1, nil
+	}
+	if err == nil {
+		fmt.Fprintf(out, "\nprograma terminou com código %v\n", code)
+	}
+	return code, err
+}
+
+func (this *debugger) hook(it *interpreter.Interpreter, n *mod.Node) *Error {
+	if n.Kind == nk.Block || n.Range == nil {
+		return nil
+	}
+	line := n.Range.Begin.Line + 1
+	depth := len(it.Stack)
+	sameLine := line == this.LastLine && depth == this.LastDepth
+	this.LastLine = line
+	this.LastDepth = depth
+
+	if !this.shouldStop(line, depth, sameLine) {
+		return nil
+	}
+	it.Out.Flush()
+	this.showLine(line)
+	return this.prompt(it)
+}
+
+func (this *debugger) shouldStop(line, depth int, sameLine bool) bool {
+	if this.Breakpoints[line] && !sameLine {
+		return true
+	}
+	switch this.Mode {
+	case stepInto:
+		return true
+	case stepOver:
+		return depth <= this.Depth
+	case stepOut:
+		return depth < this.Depth
+	}
+	return false
+}
+
+func (this *debugger) prompt(it *interpreter.Interpreter) *Error {
+	for {
+		fmt.Fprint(this.Out, "(upt) ")
+		text, e := this.In.ReadString('\n')
+		if e != nil && text == "" {
+			return errQuit
+		}
+		words := strings.Fields(text)
+		if len(words) == 0 {
+			continue
+		}
+		cmd := words[0]
+		args := words[1:]
+		depth := len(it.Stack)
+		switch cmd {
+		case "c", "continuar":
+			this.Mode = running
+			return nil
+		case "s", "passo":
+			this.Mode = stepInto
+			return nil
+		case "n", "proximo":
+			this.Mode = stepOver
+			this.Depth = depth
+			return nil
+		case "f", "finalizar":
+			this.Mode = stepOut
+			this.Depth = depth
+			return nil
+		case "p", "parar":
+			this.setBreakpoint(args, true)
+		case "r", "remover":
+			this.setBreakpoint(args, false)
+		case "v", "ver":
+			this.printVar(it, args)
+		case "l", "locais":
+			this.printLocals(it)
+		case "t", "pilha":
+			this.printStack(it)
+		case "q", "sair":
+			return errQuit
+		case "a", "ajuda":
+			fmt.Fprint(this.Out, help)
+		default:
+			fmt.Fprintf(this.Out, "comando desconhecido '%v', digite 'ajuda' para ver os comandos\n", cmd)
+		}
+	}
+}
+
+func (this *debugger) setBreakpoint(args []string, set bool) {
+	if len(args) != 1 {
+		fmt.Fprint(this.Out, "esperado o número de uma linha\n")
+		return
+	}
+	line, e := strconv.Atoi(args[0])
+	if e != nil || line < 1 || line > len(this.Lines) {
+		fmt.Fprintf(this.Out, "linha invalida: %v\n", args[0])
+		return
+	}
+	if set {
+		this.Breakpoints[line] = true
+		fmt.Fprintf(this.Out, "ponto de parada na linha %v\n", line)
+	} else {
+		delete(this.Breakpoints, line)
+		fmt.Fprintf(this.Out, "ponto de parada removido da linha %v\n", line)
+	}
+}
+
+func (this *debugger) printVar(it *interpreter.Interpreter, args []string) {
+	if len(args) != 1 {
+		fmt.Fprint(this.Out, "esperado o nome de uma variavel\n")
+		return
+	}
+	v, ok := it.Top().Lookup(args[0])
+	if !ok {
+		fmt.Fprintf(this.Out, "variavel '%v' não existe nesse ponto do programa\n", args[0])
+		return
+	}
+	fmt.Fprintf(this.Out, "%v = %v\n", args[0], format(v))
+}
+
+func (this *debugger) printLocals(it *interpreter.Interpreter) {
+	fr := it.Top()
+	names := fr.Visible()
+	if len(names) == 0 {
+		fmt.Fprint(this.Out, "nenhuma variavel visivel\n")
+		return
+	}
+	for _, name := range names {
+		v, _ := fr.Lookup(name)
+		fmt.Fprintf(this.Out, "%v %v = %v\n", v.T.String(), name, format(v))
+	}
+}
+
+func (this *debugger) printStack(it *interpreter.Interpreter) {
+	for i := len(it.Stack) - 1; i >= 0; i-- {
+		fr := it.Stack[i]
+		line := "?"
+		if fr.Curr != nil && fr.Curr.Range != nil {
+			line = strconv.Itoa(fr.Curr.Range.Begin.Line + 1)
+		}
+		fmt.Fprintf(this.Out, "#%v %v() linha %v\n", len(it.Stack)-1-i, fr.Proc.Name, line)
+	}
+}
+
+func (this *debugger) showLine(line int) {
+	text := ""
+	if line-1 < len(this.Lines) {
+		text = strings.TrimSpace(this.Lines[line-1])
+	}
+	fmt.Fprintf(this.Out, "%v:%v\t%v\n", this.M.Name, line, text)
+}
+
+func format(v *interpreter.Value) string {
+	if v.T.Basic == T.Caractere {
+		return fmt.Sprintf("'%v' (%v)", v.String(), v.Int)
+	}
+	if v.T.Basic == T.String {
+		return strconv.Quote(v.Str)
+	}
+	return v.String()
+}
@@ -0,0 +1,272 @@
+package initialization
+
+import (
+	"upt/cfg"
+	. "upt/core"
+	mod "upt/core/module"
+	T "upt/core/types"
+
+	ek "upt/core/errorkind"
+	lk "upt/core/lexeme/lexkind"
+	nk "upt/core/module/nodekind"
+	sk "upt/core/module/symbolkind"
+)
+
+// Check procura leituras de variaveis locais que podem acontecer
+// antes de qualquer atribuição, em algum caminho do procedimento.
+// Só valem as locais escalares e logicas: cadeias e registros
+// começam zerados, e vetores são verificados elemento por elemento
+// só em tempo de execução. Retorna os erros de todos os procedimentos,
+// ordenados pela posição.
+func Check(M *mod.Module) ErrorList {
+	for _, sy := range M.Global.Symbols {
+		if sy.Kind != sk.Procedure || sy.Builtin {
+			continue
+		}
+		checkProc(M, sy)
+	}
+	M.Errors.Sort()
+	return M.Errors
+}
+
+// vars é o conjunto de locais que podem não ter sido atribuidas
+type vars map[*mod.Symbol]bool
+
+func (this vars) copy() vars {
+	out := vars{}
+	for sy := range this {
+		out[sy] = true
+	}
+	return out
+}
+
+func (this vars) equals(other vars) bool {
+	if len(this) != len(other) {
+		return false
+	}
+	for sy := range this {
+		if !other[sy] {
+			return false
+		}
+	}
+	return true
+}
+
+type context struct {
+	M *mod.Module
+
+	// o simbolo de cada identificador do procedimento
+	Symbols map[*mod.Node]*mod.Symbol
+	// locais cuja declaração já foi vista
+	Declared mod.Declared
+
+	// a primeira leitura problematica de cada variavel
+	Reads map[*mod.Symbol]*mod.Node
+}
+
+func checkProc(M *mod.Module, sy *mod.Symbol) {
+	ctx := &context{
+		M:        M,
+		Symbols:  map[*mod.Node]*mod.Symbol{},
+		Declared: mod.Declared{},
+		Reads:    map[*mod.Symbol]*mod.Node{},
+	}
+	// proc := {id, args, retNode, bl}
+	resolve(ctx, sy.N.Scope, sy.N.Leaves[3])
+
+	g := cfg.Build(sy)
+	in := flow(ctx, g)
+	for _, b := range g.Blocks {
+		if g.Reachable(b) {
+			transferBlock(ctx, b, in[b].copy(), true)
+		}
+	}
+
+	for local, read := range ctx.Reads {
+		M.Errors = append(M.Errors, errorUninitializedVar(M, read, local))
+	}
+}
+
+// flow calcula, para cada bloco alcançavel, as variaveis que
+// podem chegar nele sem atribuição. Um bloco recebe a união
+// do que sai dos seus predecessores, até nada mais mudar.
+func flow(ctx *context, g *cfg.Graph) map[*cfg.Block]vars {
+	in := map[*cfg.Block]vars{}
+	out := map[*cfg.Block]vars{}
+	for _, b := range g.Blocks {
+		in[b] = vars{}
+		out[b] = vars{}
+	}
+	changed := true
+	for changed {
+		changed = false
+		for _, b := range g.Blocks {
+			if !g.Reachable(b) {
+				continue
+			}
+			curr := vars{}
+			for _, pred := range b.Pred {
+				for sy := range out[pred] {
+					curr[sy] = true
+				}
+			}
+			in[b] = curr
+			next := transferBlock(ctx, b, curr.copy(), false)
+			if !next.equals(out[b]) {
+				out[b] = next
+				changed = true
+			}
+		}
+	}
+	return in
+}
+
+// transferBlock aplica os comandos do bloco ao conjunto,
+// se report for verdadeiro as leituras problematicas são guardadas
+func transferBlock(ctx *context, b *cfg.Block, set vars, report bool) vars {
+	for _, n := range b.Nodes {
+		transfer(ctx, n, set, report)
+	}
+	return set
+}
+
+func transfer(ctx *context, n *mod.Node, set vars, report bool) {
+	switch n.Kind {
+	case nk.VarDecl:
+		// vardecl := {type, id...}
+		for _, id := range n.Leaves[1:] {
+			sy := ctx.Symbols[id]
+			if tracked(sy) {
+				set[sy] = true
+			}
+		}
+		return
+	case nk.CountedLoop:
+		// os limites já foram lidos em nós separados,
+		// aqui só acontece 'id = inicio'
+		define(ctx, n.Leaves[0], set)
+		return
+	case nk.Terminal:
+		switch n.Lexeme.Kind {
+		case lk.Assign:
+			alvo := n.Leaves[0]
+			read(ctx, n.Leaves[1], set, report)
+			if !isIdent(alvo) {
+				read(ctx, alvo, set, report)
+			}
+			define(ctx, alvo, set)
+			return
+		case lk.Leia:
+			alvo := n.Leaves[0]
+			if !isIdent(alvo) {
+				read(ctx, alvo, set, report)
+			}
+			define(ctx, alvo, set)
+			return
+		}
+	}
+	read(ctx, n, set, report)
+}
+
+// read marca as leituras da expressão, argumentos por referencia
+// podem ser atribuidos pelo procedimento chamado, então contam
+// como atribuição e não como leitura
+func read(ctx *context, n *mod.Node, set vars, report bool) {
+	if n == nil {
+		return
+	}
+	switch n.Kind {
+	case nk.Field:
+		// field := {registro, id}
+		read(ctx, n.Leaves[0], set, report)
+		return
+	case nk.Call:
+		// call := {proc, args}
+		proc := ctx.Symbols[n.Leaves[0]]
+		refs := []*mod.Node{}
+		for i, arg := range n.Leaves[1].Leaves {
+			if proc != nil && i < len(proc.Args) && proc.Args[i].Ref && isIdent(arg) {
+				refs = append(refs, arg)
+				continue
+			}
+			read(ctx, arg, set, report)
+		}
+		for _, ref := range refs {
+			define(ctx, ref, set)
+		}
+		return
+	case nk.Terminal:
+		if n.Lexeme.Kind == lk.Ident {
+			sy := ctx.Symbols[n]
+			if report && set[sy] {
+				first, ok := ctx.Reads[sy]
+				if !ok || n.Range.Begin.LessThan(first.Range.Begin) {
+					ctx.Reads[sy] = n
+				}
+			}
+			return
+		}
+	}
+	for _, leaf := range n.Leaves {
+		read(ctx, leaf, set, report)
+	}
+}
+
+func define(ctx *context, n *mod.Node, set vars) {
+	if isIdent(n) {
+		delete(set, ctx.Symbols[n])
+	}
+}
+
+func isIdent(n *mod.Node) bool {
+	return n.Kind == nk.Terminal && n.Lexeme.Kind == lk.Ident
+}
+
+func tracked(sy *mod.Symbol) bool {
+	if sy == nil || sy.Kind != sk.Local || sy.Type == nil {
+		return false
+	}
+	return T.IsScalar(sy.Type) || T.IsLogico(sy.Type)
+}
+
+// resolve associa cada identificador ao seu simbolo, seguindo a
+// mesma regra da resolução: uma local só é visivel depois da declaração
+func resolve(ctx *context, scope *mod.Scope, n *mod.Node) {
+	if n == nil {
+		return
+	}
+	switch n.Kind {
+	case nk.Block:
+		scope = n.Scope
+	case nk.VarDecl:
+		// vardecl := {type, id...}
+		for _, id := range n.Leaves[1:] {
+			sy := scope.Symbols[id.Lexeme.Text]
+			ctx.Declared[sy] = true
+			ctx.Symbols[id] = sy
+		}
+		return
+	case nk.Field:
+		// field := {registro, id}
+		resolve(ctx, scope, n.Leaves[0])
+		return
+	case nk.Terminal:
+		if n.Lexeme.Kind == lk.Ident {
+			ctx.Symbols[n] = ctx.Declared.Find(scope, n.Lexeme.Text)
+			return
+		}
+	}
+	for _, leaf := range n.Leaves {
+		resolve(ctx, scope, leaf)
+	}
+}
+
+func errorUninitializedVar(M *mod.Module, n *mod.Node, sy *mod.Symbol) *Error {
+	msg := "a variavel '" + sy.Name + "' pode ser lida antes de receber um valor"
+	err := mod.NewError(M, ek.UninitializedVar, n, msg)
+	err.Notes = []*Note{{
+		Message:  "'" + sy.Name + "' foi declarada aqui",
+		Location: mod.Place(M, sy.N),
+	}}
+	return err
+}
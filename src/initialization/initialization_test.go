@@ -0,0 +1,62 @@
+package initialization_test
+
+import (
+	"testing"
+
+	"upt/initialization"
+	"upt/parser"
+	"upt/resolution"
+	"upt/typechecker"
+)
+
+const varias = `inteiro a() {
+	inteiro x;
+	retorne x;
+}
+
+inteiro b() {
+	inteiro p, q, r;
+	retorne p + q + r;
+}
+
+inteiro c() {
+	inteiro y;
+	retorne y;
+}
+
+inteiro entrada() {
+	retorne a() + b() + c();
+}
+`
+
+// os erros vem de varios procedimentos e de varias locais,
+// e devem sair sempre na ordem do arquivo
+func TestErrorOrder(t *testing.T) {
+	expected := []int{3, 8, 8, 8, 13}
+	for i := 0; i < 20; i++ {
+		root, errs := parser.Parse("varias.uffp", varias)
+		if errs != nil {
+			t.Fatal(errs)
+		}
+		m, errs := resolution.Resolve("varias.uffp", root)
+		if errs != nil {
+			t.Fatal(errs)
+		}
+		errs = typechecker.Check(m)
+		if errs != nil {
+			t.Fatal(errs)
+		}
+		errs = initialization.Check(m)
+		if len(errs) != len(expected) {
+			t.Fatalf("esperado %v erros, recebido %v", len(expected), errs)
+		}
+		for j, err := range errs {
+			if j > 0 && !errs[j-1].Before(err) {
+				t.Fatalf("erros fora de ordem: %v", errs)
+			}
+			if err.Location.Range.Begin.Line+1 != expected[j] {
+				t.Fatalf("erro %v na linha %v, esperado %v", j, err.Location.Range.Begin.Line+1, expected[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,1188 @@
+package interpreter
+
+import (
+	. "upt/core"
+	mod "upt/core/module"
+	T "upt/core/types"
+
+	ek "upt/core/errorkind"
+	lk "upt/core/lexeme/lexkind"
+	nk "upt/core/module/nodekind"
+	sk "upt/core/module/symbolkind"
+
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// o interpretador executa o módulo tipado diretamente,
+// seguindo a semantica do C gerado pelo cgen. Ele é usado pelo
+// depurador: percorrer a arvore mantém as posições no codigo
+// fonte, que o passo a passo precisa. O -run executa a saida
+// de linearization, veja ir.go.
+
+const MaxDepth = 10000
+
+type Value struct {
+	T    *T.Type
+	Int  int64 // inteiro e caractere
+	Real float64
+	Str  string
+
+	Elems  []*Value // só para vetores
+	Fields []*Value // só para registros, na ordem da declaração
+}
+
+func (this *Value) String() string {
+	if T.IsArray(this.T) {
+		elems := []string{}
+		for _, e := range this.Elems {
+			elems = append(elems, e.String())
+		}
+		return "{" + strings.Join(elems, ", ") + "}"
+	}
+	if T.IsRecord(this.T) {
+		fields := []string{}
+		for i, f := range this.Fields {
+			fields = append(fields, this.T.Record.Fields[i].Name+": "+f.String())
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	switch this.T.Basic {
+	case T.Inteiro:
+		return strconv.FormatInt(this.Int, 10)
+	case T.Caractere:
+		return string(rune(byte(this.Int)))
+	case T.Real:
+		return fmt.Sprintf("%f", this.Real)
+	case T.String:
+		return this.Str
+	case T.Logico:
+		if this.Int != 0 {
+			return "verdadeiro"
+		}
+		return "falso"
+	}
+	return "invalid"
+}
+
+type flow int
+
+const (
+	next flow = iota
+	ret
+	brk  // pare
+	cont // continue
+)
+
+type scopedSymbol struct {
+	ScopeID int
+	Name    string
+}
+
+type Frame struct {
+	Proc   *mod.Symbol
+	Vars   map[scopedSymbol]*Value
+	Return *Value
+
+	// compartilhado entre todos os frames
+	Globals map[string]*Value
+
+	// comando sendo executado e o seu escopo
+	Curr  *mod.Node
+	Scope *mod.Scope
+}
+
+// Lookup procura uma variavel pelo seu nome em Portugol,
+// a partir do escopo do comando atual
+func (this *Frame) Lookup(name string) (*Value, bool) {
+	if this.Scope == nil {
+		return nil, false
+	}
+	sy, sc := this.Scope.FindWithScope(name)
+	if sy == nil {
+		return nil, false
+	}
+	switch sy.Kind {
+	case sk.Global, sk.Constant:
+		v, ok := this.Globals[name]
+		return v, ok
+	}
+	v, ok := this.Vars[scopedSymbol{ScopeID: sc.ID, Name: name}]
+	return v, ok
+}
+
+// Visible retorna os nomes das variaveis já declaradas
+// que são visiveis a partir do comando atual
+func (this *Frame) Visible() []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for sc := this.Scope; sc != nil; sc = sc.Parent {
+		for name := range sc.Symbols {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			_, ok := this.Lookup(name)
+			if ok {
+				out = append(out, name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func newFrame(proc *mod.Symbol, globals map[string]*Value) *Frame {
+	return &Frame{
+		Proc:    proc,
+		Vars:    map[scopedSymbol]*Value{},
+		Globals: globals,
+	}
+}
+
+type Interpreter struct {
+	M     *mod.Module
+	In    *bufio.Reader
+	Out   *bufio.Writer
+	Stack []*Frame
+
+	// variaveis globais e constantes
+	Globals map[string]*Value
+
+	// se não for zero, o programa é interrompido
+	// quando passar desse tempo
+	Deadline time.Time
+
+	// se não for nil, é chamado antes de cada comando,
+	// um erro interrompe a execução
+	Hook func(it *Interpreter, n *mod.Node) *Error
+}
+
+func NewInterpreter(M *mod.Module, in io.Reader, out io.Writer) *Interpreter {
+	return &Interpreter{
+		M:       M,
+		In:      bufio.NewReader(in),
+		Out:     bufio.NewWriter(out),
+		Stack:   []*Frame{},
+		Globals: initGlobals(M),
+	}
+}
+
+func initGlobals(M *mod.Module) map[string]*Value {
+	globals := map[string]*Value{}
+	for name, sy := range M.Global.Symbols {
+		switch sy.Kind {
+		case sk.Global:
+			v := zeroValue(sy.Type)
+			globals[name] = &v
+		case sk.Constant:
+			globals[name] = constToValue(sy)
+		}
+	}
+	return globals
+}
+
+func constToValue(sy *mod.Symbol) *Value {
+	switch v := sy.Value.(type) {
+	case int64:
+		return &Value{T: sy.Type, Int: v}
+	case float64:
+		return &Value{T: sy.Type, Real: v}
+	case bool:
+		return boolValue(v)
+	case string:
+		// a cadeia está escrita como no fonte
+		return &Value{T: sy.Type, Str: truncate(unescape(v))}
+	}
+	panic("unreachable")
+}
+
+// Run executa o procedimento 'entrada' e retorna o seu valor,
+// que é o código de saída do programa
+func (this *Interpreter) Run() (int, *Error) {
+	defer this.Out.Flush()
+	entrada := this.M.Global.Find("entrada")
+	v, err := call(this, entrada.N, entrada, []*Value{})
+	if err != nil {
+		return 1, err
+	}
+	return int(int32(v.Int)), nil
+}
+
+func (this *Interpreter) Top() *Frame {
+	return this.Stack[len(this.Stack)-1]
+}
+
+func (this *Interpreter) checkDeadline(n *mod.Node) *Error {
+	if !this.Deadline.IsZero() && time.Now().After(this.Deadline) {
+		return errorTimeout(this.M, n)
+	}
+	return nil
+}
+
+func call(it *Interpreter, n *mod.Node, sy *mod.Symbol, args []*Value) (*Value, *Error) {
+	if len(it.Stack) >= MaxDepth {
+		return nil, errorStackOverflow(it.M, n)
+	}
+	err := it.checkDeadline(n)
+	if err != nil {
+		return nil, err
+	}
+	fr := newFrame(sy, it.Globals)
+	scope := sy.N.Scope
+	for i, arg := range sy.Args {
+		ss := scopedSymbol{ScopeID: scope.ID, Name: arg.Name}
+		if arg.Ref {
+			// o argumento compartilha o valor com quem chamou
+			fr.Vars[ss] = args[i]
+			continue
+		}
+		v := convert(args[i], arg.T)
+		fr.Vars[ss] = &v
+	}
+
+	it.Stack = append(it.Stack, fr)
+	bl := sy.N.Leaves[3]
+	_, err = execBlock(it, scope, bl)
+	it.Stack = it.Stack[:len(it.Stack)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	retType := sy.Type.Proc.Ret
+	if fr.Return == nil {
+		// o procedimento terminou sem 'retorne'
+		v := zeroValue(retType)
+		return &v, nil
+	}
+	return fr.Return, nil
+}
+
+func execBlock(it *Interpreter, scope *mod.Scope, bl *mod.Node) (flow, *Error) {
+	scope = bl.Scope
+	for _, cmd := range bl.Leaves {
+		f, err := execCmd(it, scope, cmd)
+		if err != nil || f != next {
+			return f, err
+		}
+	}
+	return next, nil
+}
+
+func execCmd(it *Interpreter, scope *mod.Scope, n *mod.Node) (flow, *Error) {
+	fr := it.Top()
+	fr.Curr = n
+	fr.Scope = scope
+	if it.Hook != nil {
+		err := it.Hook(it, n)
+		if err != nil {
+			return next, err
+		}
+	}
+	switch n.Kind {
+	case nk.Terminal:
+		switch n.Lexeme.Kind {
+		case lk.Leia:
+			return next, execLeia(it, scope, n)
+		case lk.Imprima:
+			return next, execImprima(it, scope, n)
+		case lk.Se:
+			return execSe(it, scope, n)
+		case lk.Enquanto:
+			return execEnquanto(it, scope, n)
+		case lk.Faca:
+			return execFaca(it, scope, n)
+		case lk.Escolha:
+			return execEscolha(it, scope, n)
+		case lk.Para:
+			return execPara(it, scope, n)
+		case lk.Retorne:
+			return execRetorne(it, scope, n)
+		case lk.Pare:
+			return brk, nil
+		case lk.Continue:
+			return cont, nil
+		case lk.Assign:
+			return next, execAtrib(it, scope, n)
+		}
+	case nk.CountedLoop:
+		return execParaDe(it, scope, n)
+	case nk.Block:
+		return execBlock(it, scope, n)
+	case nk.VarDecl:
+		execVarDecl(it, scope, n)
+		return next, nil
+	}
+	_, err := eval(it, scope, n)
+	return next, err
+}
+
+func execLeia(it *Interpreter, scope *mod.Scope, n *mod.Node) *Error {
+	v, err := lvalue(it, scope, n.Leaves[0])
+	if err != nil {
+		return err
+	}
+	// igual ao scanf, se a entrada for invalida
+	// a variavel não é modificada
+	switch v.T.Basic {
+	case T.Inteiro:
+		i, ok := readInt(it.In)
+		if ok {
+			v.Int = int64(int32(i))
+		}
+	case T.Caractere:
+		b, err := it.In.ReadByte()
+		if err == nil {
+			v.Int = int64(int8(b))
+		}
+	case T.Real:
+		r, ok := readReal(it.In)
+		if ok {
+			v.Real = r
+		}
+	case T.String:
+		s, ok := readLine(it.In)
+		if ok {
+			v.Str = s
+		}
+	}
+	return nil
+}
+
+func execImprima(it *Interpreter, scope *mod.Scope, n *mod.Node) *Error {
+	arg := n.Leaves[0]
+	if arg.Lexeme != nil && arg.Lexeme.Kind == lk.StringLit {
+		// a gente mantem as aspas no token da string
+		text := arg.Lexeme.Text
+		it.Out.WriteString(unescape(text[1 : len(text)-1]))
+		return nil
+	}
+	v, err := eval(it, scope, arg)
+	if err != nil {
+		return err
+	}
+	it.Out.WriteString(v.String())
+	return nil
+}
+
+func execSe(it *Interpreter, scope *mod.Scope, n *mod.Node) (flow, *Error) {
+	// se := {cond, block, senao}
+	cond, err := eval(it, scope, n.Leaves[0])
+	if err != nil {
+		return next, err
+	}
+	if isTrue(cond) {
+		return execBlock(it, scope, n.Leaves[1])
+	}
+	sn := n.Leaves[2]
+	if sn != nil {
+		return execBlock(it, scope, sn)
+	}
+	return next, nil
+}
+
+func execEnquanto(it *Interpreter, scope *mod.Scope, n *mod.Node) (flow, *Error) {
+	// enquanto := {cond, block}
+	for {
+		err := it.checkDeadline(n)
+		if err != nil {
+			return next, err
+		}
+		cond, err := eval(it, scope, n.Leaves[0])
+		if err != nil {
+			return next, err
+		}
+		if !isTrue(cond) {
+			return next, nil
+		}
+		f, err := execBlock(it, scope, n.Leaves[1])
+		if err != nil || f == ret {
+			return f, err
+		}
+		if f == brk {
+			return next, nil
+		}
+	}
+}
+
+func execEscolha(it *Interpreter, scope *mod.Scope, n *mod.Node) (flow, *Error) {
+	// escolha := {expr, caso...}
+	v, err := eval(it, scope, n.Leaves[0])
+	if err != nil {
+		return next, err
+	}
+	for _, c := range n.Leaves[1:] {
+		// caso := {labels, block}
+		// outrocaso := {block}
+		if c.Lexeme.Kind == lk.Caso && !matchesCase(c, v) {
+			continue
+		}
+		return execBlock(it, scope, c.Leaves[len(c.Leaves)-1])
+	}
+	return next, nil
+}
+
+func matchesCase(c *mod.Node, v *Value) bool {
+	for _, label := range c.Leaves[0].Leaves {
+		if label.Value.(int64) == v.Int {
+			return true
+		}
+	}
+	return false
+}
+
+func execFaca(it *Interpreter, scope *mod.Scope, n *mod.Node) (flow, *Error) {
+	// faca := {block, cond}
+	for {
+		err := it.checkDeadline(n)
+		if err != nil {
+			return next, err
+		}
+		f, err := execBlock(it, scope, n.Leaves[0])
+		if err != nil || f == ret {
+			return f, err
+		}
+		if f == brk {
+			return next, nil
+		}
+		cond, err := eval(it, scope, n.Leaves[1])
+		if err != nil {
+			return next, err
+		}
+		if !isTrue(cond) {
+			return next, nil
+		}
+	}
+}
+
+func execPara(it *Interpreter, scope *mod.Scope, n *mod.Node) (flow, *Error) {
+	// para := {atrib, cond, atrib, block}
+	if n.Leaves[0] != nil {
+		err := execAtrib(it, scope, n.Leaves[0])
+		if err != nil {
+			return next, err
+		}
+	}
+	for {
+		err := it.checkDeadline(n)
+		if err != nil {
+			return next, err
+		}
+		cond, err := eval(it, scope, n.Leaves[1])
+		if err != nil {
+			return next, err
+		}
+		if !isTrue(cond) {
+			return next, nil
+		}
+		f, err := execBlock(it, scope, n.Leaves[3])
+		if err != nil || f == ret {
+			return f, err
+		}
+		if f == brk {
+			return next, nil
+		}
+		err = execAtrib(it, scope, n.Leaves[2])
+		if err != nil {
+			return next, err
+		}
+	}
+}
+
+// o fim e o passo são calculados uma unica vez, antes da primeira iteração
+func execParaDe(it *Interpreter, scope *mod.Scope, n *mod.Node) (flow, *Error) {
+	// paraDe := {id, inicio, fim, passo, block}
+	i, err := lvalue(it, scope, n.Leaves[0])
+	if err != nil {
+		return next, err
+	}
+	inicio, err := eval(it, scope, n.Leaves[1])
+	if err != nil {
+		return next, err
+	}
+	*i = convert(inicio, i.T)
+	fim, err := eval(it, scope, n.Leaves[2])
+	if err != nil {
+		return next, err
+	}
+	passo := int64(1)
+	if n.Leaves[3] != nil {
+		v, err := eval(it, scope, n.Leaves[3])
+		if err != nil {
+			return next, err
+		}
+		passo = v.Int
+	}
+	for {
+		err := it.checkDeadline(n)
+		if err != nil {
+			return next, err
+		}
+		if passo > 0 && i.Int > fim.Int || passo <= 0 && i.Int < fim.Int {
+			return next, nil
+		}
+		f, err := execBlock(it, scope, n.Leaves[4])
+		if err != nil || f == ret {
+			return f, err
+		}
+		if f == brk {
+			return next, nil
+		}
+		i.Int = wrap(i.Int+passo, i.T)
+	}
+}
+
+func execRetorne(it *Interpreter, scope *mod.Scope, n *mod.Node) (flow, *Error) {
+	if n.Leaves[0] == nil {
+		// procedimento vazio, não há o que guardar
+		return ret, nil
+	}
+	v, err := eval(it, scope, n.Leaves[0])
+	if err != nil {
+		return next, err
+	}
+	fr := it.Top()
+	out := convert(v, fr.Proc.Type.Proc.Ret)
+	fr.Return = &out
+	return ret, nil
+}
+
+func execAtrib(it *Interpreter, scope *mod.Scope, n *mod.Node) *Error {
+	dest, err := lvalue(it, scope, n.Leaves[0])
+	if err != nil {
+		return err
+	}
+	var v *Value
+	if mod.IsCompound(n) {
+		// o lado esquerdo da operação é o proprio alvo,
+		// que já foi encontrado
+		bin := n.Leaves[1]
+		a := copyValue(dest)
+		b, err := eval(it, scope, bin.Leaves[1])
+		if err != nil {
+			return err
+		}
+		v, err = arith(it, bin, &a, b)
+		if err != nil {
+			return err
+		}
+	} else {
+		v, err = eval(it, scope, n.Leaves[1])
+	}
+	if err != nil {
+		return err
+	}
+	*dest = convert(v, dest.T)
+	return nil
+}
+
+func execVarDecl(it *Interpreter, scope *mod.Scope, n *mod.Node) {
+	// vardecl := {type, id...}
+	fr := it.Top()
+	for _, id := range n.Leaves[1:] {
+		ss := scopedSymbol{ScopeID: scope.ID, Name: id.Lexeme.Text}
+		v := zeroValue(id.T)
+		fr.Vars[ss] = &v
+	}
+}
+
+func eval(it *Interpreter, scope *mod.Scope, n *mod.Node) (*Value, *Error) {
+	switch n.Kind {
+	case nk.Terminal:
+		switch n.Lexeme.Kind {
+		case lk.Ou, lk.E:
+			return evalLogical(it, scope, n)
+		case lk.Equals, lk.Different,
+			lk.Greater, lk.GreaterOrEquals, lk.Less, lk.LessOrEquals:
+			return evalComparison(it, scope, n)
+		case lk.Plus, lk.Star, lk.Division, lk.Remainder, lk.Caret:
+			return evalArith(it, scope, n)
+		case lk.Nao:
+			v, err := eval(it, scope, n.Leaves[0])
+			if err != nil {
+				return nil, err
+			}
+			return boolValue(!isTrue(v)), nil
+		case lk.Minus:
+			if len(n.Leaves) == 1 {
+				v, err := eval(it, scope, n.Leaves[0])
+				if err != nil {
+					return nil, err
+				}
+				out := convert(v, n.T)
+				out.Int = wrap(-out.Int, n.T)
+				out.Real = -out.Real
+				return &out, nil
+			}
+			return evalArith(it, scope, n)
+		case lk.IntLit, lk.RealLit, lk.CharLit, lk.StringLit,
+			lk.Verdadeiro, lk.Falso:
+			return litToValue(n), nil
+		case lk.Ident:
+			v := findVar(it, scope, n.Lexeme.Text)
+			out := copyValue(v)
+			return &out, nil
+		}
+	case nk.Call:
+		return evalCall(it, scope, n)
+	case nk.Index, nk.Field:
+		v, err := lvalue(it, scope, n)
+		if err != nil {
+			return nil, err
+		}
+		out := copyValue(v)
+		return &out, nil
+	}
+	fmt.Println(n)
+	panic("unreachable")
+}
+
+func evalCall(it *Interpreter, scope *mod.Scope, n *mod.Node) (*Value, *Error) {
+	proc := n.Leaves[0]
+	sy := scope.Find(proc.Lexeme.Text)
+	if sy == nil || sy.Kind != sk.Procedure {
+		panic("call to non procedure")
+	}
+	args := []*Value{}
+	for i, expr := range n.Leaves[1].Leaves {
+		var v *Value
+		var err *Error
+		if sy.Args[i].Ref {
+			v, err = lvalue(it, scope, expr)
+		} else {
+			v, err = eval(it, scope, expr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	if sy.Builtin {
+		return callBuiltin(it, n, sy, args)
+	}
+	return call(it, n, sy, args)
+}
+
+// builtin recebe os argumentos já convertidos pros tipos da assinatura
+// e calcula o resultado, que é convertido pro tipo de retorno
+type builtin func(it *Interpreter, n *mod.Node, x []Value) (*Value, *Error)
+
+// os embutidos se comportam como as funções usadas no C gerado
+var builtins = map[string]builtin{
+	"raiz":      realFunc(math.Sqrt),
+	"expo":      realFunc2(math.Pow),
+	"abs":       realFunc(math.Abs),
+	"piso":      realFunc(math.Floor),
+	"teto":      realFunc(math.Ceil),
+	"arredonda": realFunc(math.Round),
+	"sen":       realFunc(math.Sin),
+	"cos":       realFunc(math.Cos),
+	"tan":       realFunc(math.Tan),
+	"log":       realFunc(math.Log10),
+	"ln":        realFunc(math.Log),
+	"pi":        builtinPi,
+	"max":       realFunc2(math.Max),
+	"min":       realFunc2(math.Min),
+	"quociente": builtinQuociente,
+	"resto":     builtinResto,
+	"aleatorio": builtinAleatorio,
+}
+
+func callBuiltin(it *Interpreter, n *mod.Node, sy *mod.Symbol, args []*Value) (*Value, *Error) {
+	x := []Value{}
+	for i, arg := range args {
+		x = append(x, convert(arg, sy.Args[i].T))
+	}
+	res, err := builtins[sy.Name](it, n, x)
+	if err != nil {
+		return nil, err
+	}
+	out := convert(res, sy.Type.Proc.Ret)
+	return &out, nil
+}
+
+func realFunc(f func(float64) float64) builtin {
+	return func(it *Interpreter, n *mod.Node, x []Value) (*Value, *Error) {
+		return &Value{T: T.T_Real, Real: f(x[0].Real)}, nil
+	}
+}
+
+func realFunc2(f func(float64, float64) float64) builtin {
+	return func(it *Interpreter, n *mod.Node, x []Value) (*Value, *Error) {
+		return &Value{T: T.T_Real, Real: f(x[0].Real, x[1].Real)}, nil
+	}
+}
+
+func builtinPi(it *Interpreter, n *mod.Node, x []Value) (*Value, *Error) {
+	return &Value{T: T.T_Real, Real: math.Pi}, nil
+}
+
+func builtinQuociente(it *Interpreter, n *mod.Node, x []Value) (*Value, *Error) {
+	if x[1].Int == 0 {
+		return nil, errorDivisionByZero(it.M, n)
+	}
+	return &Value{T: T.T_Inteiro, Int: wrap(x[0].Int/x[1].Int, T.T_Inteiro)}, nil
+}
+
+func builtinResto(it *Interpreter, n *mod.Node, x []Value) (*Value, *Error) {
+	if x[1].Int == 0 {
+		return nil, errorDivisionByZero(it.M, n)
+	}
+	return &Value{T: T.T_Inteiro, Int: x[0].Int % x[1].Int}, nil
+}
+
+// sorteia um inteiro entre a e b, incluindo os dois
+func builtinAleatorio(it *Interpreter, n *mod.Node, x []Value) (*Value, *Error) {
+	a, b := x[0].Int, x[1].Int
+	if a > b {
+		a, b = b, a
+	}
+	return &Value{T: T.T_Inteiro, Int: a + rand.Int63n(b-a+1)}, nil
+}
+
+// 'e' e 'ou' tem curto-circuito, assim como em C
+func evalLogical(it *Interpreter, scope *mod.Scope, n *mod.Node) (*Value, *Error) {
+	a, err := eval(it, scope, n.Leaves[0])
+	if err != nil {
+		return nil, err
+	}
+	if n.Lexeme.Kind == lk.E && !isTrue(a) {
+		return boolValue(false), nil
+	}
+	if n.Lexeme.Kind == lk.Ou && isTrue(a) {
+		return boolValue(true), nil
+	}
+	b, err := eval(it, scope, n.Leaves[1])
+	if err != nil {
+		return nil, err
+	}
+	return boolValue(isTrue(b)), nil
+}
+
+// comparações são feitas no tipo comum entre os operandos
+func evalComparison(it *Interpreter, scope *mod.Scope, n *mod.Node) (*Value, *Error) {
+	a, err := eval(it, scope, n.Leaves[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := eval(it, scope, n.Leaves[1])
+	if err != nil {
+		return nil, err
+	}
+	if T.IsString(a.T) {
+		// cadeias só são comparadas com '==' e '!='
+		equal := a.Str == b.Str
+		if n.Lexeme.Kind == lk.Different {
+			return boolValue(!equal), nil
+		}
+		return boolValue(equal), nil
+	}
+	if T.IsLogico(a.T) {
+		equal := a.Int == b.Int
+		if n.Lexeme.Kind == lk.Different {
+			return boolValue(!equal), nil
+		}
+		return boolValue(equal), nil
+	}
+	var cmp int
+	common := &T.Type{Basic: T.ConversionTable[a.T.Basic][b.T.Basic]}
+	x := convert(a, common)
+	y := convert(b, common)
+	if common.Basic == T.Real {
+		cmp = compareReal(x.Real, y.Real)
+	} else {
+		cmp = compareInt(x.Int, y.Int)
+	}
+	var res bool
+	switch n.Lexeme.Kind {
+	case lk.Equals:
+		res = cmp == 0
+	case lk.Different:
+		res = cmp != 0
+	case lk.Greater:
+		res = cmp > 0
+	case lk.GreaterOrEquals:
+		res = cmp >= 0
+	case lk.Less:
+		res = cmp < 0
+	case lk.LessOrEquals:
+		res = cmp <= 0
+	}
+	return boolValue(res), nil
+}
+
+// os dois lados da expressão são convertidos pro tipo
+// do resultado, como definido em T.ConversionTable
+func evalArith(it *Interpreter, scope *mod.Scope, n *mod.Node) (*Value, *Error) {
+	a, err := eval(it, scope, n.Leaves[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := eval(it, scope, n.Leaves[1])
+	if err != nil {
+		return nil, err
+	}
+	return arith(it, n, a, b)
+}
+
+func arith(it *Interpreter, n *mod.Node, a, b *Value) (*Value, *Error) {
+	x := convert(a, n.T)
+	y := convert(b, n.T)
+	out := Value{T: n.T}
+	if n.T.Basic == T.Real {
+		switch n.Lexeme.Kind {
+		case lk.Plus:
+			out.Real = x.Real + y.Real
+		case lk.Minus:
+			out.Real = x.Real - y.Real
+		case lk.Star:
+			out.Real = x.Real * y.Real
+		case lk.Division:
+			out.Real = x.Real / y.Real
+		case lk.Caret:
+			out.Real = math.Pow(x.Real, y.Real)
+		}
+		return &out, nil
+	}
+	switch n.Lexeme.Kind {
+	case lk.Plus:
+		out.Int = x.Int + y.Int
+	case lk.Minus:
+		out.Int = x.Int - y.Int
+	case lk.Star:
+		out.Int = x.Int * y.Int
+	case lk.Caret:
+		// como no C gerado, a potencia é calculada em double
+		out.Int = int64(math.Pow(float64(x.Int), float64(y.Int)))
+	case lk.Division:
+		if y.Int == 0 {
+			return nil, errorDivisionByZero(it.M, n)
+		}
+		out.Int = x.Int / y.Int
+	case lk.Remainder:
+		if y.Int == 0 {
+			return nil, errorDivisionByZero(it.M, n)
+		}
+		out.Int = x.Int % y.Int
+	}
+	out.Int = wrap(out.Int, n.T)
+	return &out, nil
+}
+
+func litToValue(n *mod.Node) *Value {
+	switch n.Lexeme.Kind {
+	case lk.CharLit:
+		return &Value{T: T.T_Caractere, Int: n.Lexeme.Value.(int64)}
+	case lk.IntLit:
+		return &Value{T: T.T_Inteiro, Int: wrap(n.Lexeme.Value.(int64), T.T_Inteiro)}
+	case lk.RealLit:
+		return &Value{T: T.T_Real, Real: n.Lexeme.Value.(float64)}
+	case lk.Verdadeiro:
+		return boolValue(true)
+	case lk.Falso:
+		return boolValue(false)
+	case lk.StringLit:
+		// a gente mantem as aspas no token da string
+		text := n.Lexeme.Text
+		return &Value{T: T.T_String, Str: truncate(unescape(text[1 : len(text)-1]))}
+	}
+	panic("unreachable")
+}
+
+// lvalue retorna a variavel, o elemento de vetor ou o campo
+// que o nó referencia, para que possa ser modificado
+func lvalue(it *Interpreter, scope *mod.Scope, n *mod.Node) (*Value, *Error) {
+	if n.Kind == nk.Field {
+		// field := {registro, id}
+		reg, err := lvalue(it, scope, n.Leaves[0])
+		if err != nil {
+			return nil, err
+		}
+		return reg.Fields[fieldIndex(reg.T, n.Leaves[1].Lexeme.Text)], nil
+	}
+	if n.Kind == nk.Call {
+		// o registro retornado não é uma variavel, mas
+		// seus campos ainda podem ser lidos
+		return evalCall(it, scope, n)
+	}
+	if n.Kind != nk.Index {
+		return findVar(it, scope, n.Lexeme.Text), nil
+	}
+	// index := {vetor, expr}
+	vetor, err := lvalue(it, scope, n.Leaves[0])
+	if err != nil {
+		return nil, err
+	}
+	idx, err := eval(it, scope, n.Leaves[1])
+	if err != nil {
+		return nil, err
+	}
+	if idx.Int < 0 || idx.Int >= int64(len(vetor.Elems)) {
+		return nil, errorIndexOutOfBounds(it.M, n, idx.Int, len(vetor.Elems))
+	}
+	return vetor.Elems[idx.Int], nil
+}
+
+func findVar(it *Interpreter, scope *mod.Scope, name string) *Value {
+	sy, sc := scope.FindWithScope(name)
+	switch sy.Kind {
+	case sk.Global, sk.Constant:
+		return it.Globals[name]
+	}
+	ss := scopedSymbol{
+		ScopeID: sc.ID,
+		Name:    name,
+	}
+	v, ok := it.Top().Vars[ss]
+	if !ok {
+		fmt.Println(sc.ID, name)
+		panic("symbol not found")
+	}
+	return v
+}
+
+func zeroValue(t *T.Type) Value {
+	if T.IsArray(t) {
+		elems := make([]*Value, t.Array.Len)
+		for i := range elems {
+			v := zeroValue(t.Array.Elem)
+			elems[i] = &v
+		}
+		return Value{T: t, Elems: elems}
+	}
+	if T.IsRecord(t) {
+		fields := make([]*Value, len(t.Record.Fields))
+		for i, f := range t.Record.Fields {
+			v := zeroValue(f.T)
+			fields[i] = &v
+		}
+		return Value{T: t, Fields: fields}
+	}
+	return Value{T: t}
+}
+
+// copyValue copia vetores e registros por inteiro,
+// já que registros são passados e atribuidos por valor
+func copyValue(v *Value) Value {
+	out := *v
+	if v.Elems != nil {
+		out.Elems = make([]*Value, len(v.Elems))
+		for i, e := range v.Elems {
+			c := copyValue(e)
+			out.Elems[i] = &c
+		}
+	}
+	if v.Fields != nil {
+		out.Fields = make([]*Value, len(v.Fields))
+		for i, f := range v.Fields {
+			c := copyValue(f)
+			out.Fields[i] = &c
+		}
+	}
+	return out
+}
+
+func fieldIndex(t *T.Type, name string) int {
+	for i, f := range t.Record.Fields {
+		if f.Name == name {
+			return i
+		}
+	}
+	panic("field not found")
+}
+
+func boolValue(b bool) *Value {
+	if b {
+		return &Value{T: T.T_Logico, Int: 1}
+	}
+	return &Value{T: T.T_Logico, Int: 0}
+}
+
+func isTrue(v *Value) bool {
+	if v.T.Basic == T.Real {
+		return v.Real != 0
+	}
+	return v.Int != 0
+}
+
+// convert segue as conversões implicitas de C
+func convert(v *Value, t *T.Type) Value {
+	if v.T.Basic == t.Basic {
+		return *v
+	}
+	out := Value{T: t}
+	if v.T.Basic == T.Real {
+		out.Int = wrap(int64(v.Real), t)
+		out.Real = v.Real
+		return out
+	}
+	out.Int = wrap(v.Int, t)
+	out.Real = float64(v.Int)
+	return out
+}
+
+// wrap trunca o valor pro tamanho do tipo em C
+func wrap(i int64, t *T.Type) int64 {
+	switch t.Basic {
+	case T.Inteiro:
+		return int64(int32(i))
+	case T.Caractere:
+		return int64(int8(i))
+	}
+	return i
+}
+
+func compareInt(a, b int64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareReal(a, b float64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// MaxString é o tamanho maximo de uma cadeia, igual ao
+// UPT_CADEIA_MAX do C gerado, sem contar o '\0'
+const MaxString = 255
+
+func truncate(s string) string {
+	if len(s) > MaxString {
+		return s[:MaxString]
+	}
+	return s
+}
+
+// readLine segue o upt_cadeia_leia do C gerado: ignora os espaços
+// antes da linha e lê até a quebra de linha
+func readLine(in *bufio.Reader) (string, bool) {
+	skipSpaces(in)
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", false
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.ReplaceAll(line, "\r", "")
+	return truncate(line), true
+}
+
+func skipSpaces(in *bufio.Reader) {
+	for {
+		b, err := in.ReadByte()
+		if err != nil {
+			return
+		}
+		switch b {
+		case ' ', '\t', '\n', '\r':
+		default:
+			in.UnreadByte()
+			return
+		}
+	}
+}
+
+// readWhile lê bytes enquanto eles pertencerem a 'set'
+func readWhile(in *bufio.Reader, set string) string {
+	out := []byte{}
+	for {
+		b, err := in.ReadByte()
+		if err != nil {
+			return string(out)
+		}
+		if !strings.ContainsRune(set, rune(b)) {
+			in.UnreadByte()
+			return string(out)
+		}
+		out = append(out, b)
+	}
+}
+
+func readInt(in *bufio.Reader) (int64, bool) {
+	skipSpaces(in)
+	sign := readWhile(in, "+-")
+	digits := readWhile(in, "0123456789")
+	i, err := strconv.ParseInt(sign+digits, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return i, true
+}
+
+func readReal(in *bufio.Reader) (float64, bool) {
+	skipSpaces(in)
+	text := readWhile(in, "+-0123456789.eE")
+	r, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, false
+	}
+	return r, true
+}
+
+// errors -----------
+
+func errorDivisionByZero(M *mod.Module, n *mod.Node) *Error {
+	return mod.NewError(M, ek.RuntimeError, n, "divisão por zero")
+}
+
+func errorStackOverflow(M *mod.Module, n *mod.Node) *Error {
+	return mod.NewError(M, ek.RuntimeError, n, "estouro de pilha: muitas chamadas aninhadas")
+}
+
+func errorTimeout(M *mod.Module, n *mod.Node) *Error {
+	return mod.NewError(M, ek.RuntimeError, n, "tempo de execução esgotado")
+}
+
+func errorIndexOutOfBounds(M *mod.Module, n *mod.Node, i int64, size int) *Error {
+	msg := fmt.Sprintf("indice %v fora dos limites do vetor '%v' de tamanho %v",
+		i, baseName(n), size)
+	return mod.NewError(M, ek.RuntimeError, n, msg)
+}
+
+func baseName(n *mod.Node) string {
+	switch n.Kind {
+	case nk.Index:
+		return baseName(n.Leaves[0])
+	case nk.Field:
+		return baseName(n.Leaves[0]) + "." + n.Leaves[1].Lexeme.Text
+	}
+	return n.Lexeme.Text
+}
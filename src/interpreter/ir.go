@@ -0,0 +1,709 @@
+package interpreter
+
+import (
+	. "upt/core"
+	mod "upt/core/module"
+	T "upt/core/types"
+
+	ek "upt/core/errorkind"
+	sv "upt/core/severity"
+
+	ir "github.com/padeir0/pir"
+	irc "github.com/padeir0/pir/class"
+	FK "github.com/padeir0/pir/flowkind"
+	IK "github.com/padeir0/pir/instrkind"
+	irT "github.com/padeir0/pir/types"
+
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a maquina executa o programa produzido por linearization,
+// que é o que -run usa. Todo valor cabe num int64: inteiros
+// com sinal, os bits dos reais, 0 ou 1 pros booleanos, e ponteiros.
+// A memória é dividida em blocos, um pra cada chamada a 'aloca'
+// e um pra cada declaração de memória do programa. Um ponteiro
+// guarda o número do bloco nos 32 bits de cima e a posição dentro
+// dele nos de baixo, e o ponteiro nulo é a cadeia vazia.
+
+type machine struct {
+	M   *mod.Module
+	P   *ir.Program
+	In  *bufio.Reader
+	Out *bufio.Writer
+
+	Memory    map[int64][]byte
+	NextBlock int64
+	// o endereço de cada declaração de memória
+	Decls map[ir.SymbolID]int64
+
+	// o simbolo de cada procedimento, pra mostrar onde
+	// aconteceu um estouro de pilha ou o fim do tempo
+	Procs map[string]*mod.Symbol
+	Depth int
+
+	Deadline time.Time
+	Steps    int
+}
+
+type irFrame struct {
+	Proc  *ir.Procedure
+	Args  []int64
+	Vars  []int64
+	Temps []int64
+}
+
+// RunProgram executa o procedimento de entrada do programa
+// linearizado e retorna o seu valor, que é o código de saída
+func RunProgram(M *mod.Module, p *ir.Program, in io.Reader, out io.Writer) (int, *Error) {
+	return newMachine(M, p, in, out).run()
+}
+
+func RunProgramWithTimeout(M *mod.Module, p *ir.Program, in io.Reader, out io.Writer, d time.Duration) (int, *Error) {
+	m := newMachine(M, p, in, out)
+	m.Deadline = time.Now().Add(d)
+	return m.run()
+}
+
+func newMachine(M *mod.Module, p *ir.Program, in io.Reader, out io.Writer) *machine {
+	m := &machine{
+		M:         M,
+		P:         p,
+		In:        bufio.NewReader(in),
+		Out:       bufio.NewWriter(out),
+		Memory:    map[int64][]byte{},
+		NextBlock: 1,
+		Decls:     map[ir.SymbolID]int64{},
+		Procs:     map[string]*mod.Symbol{},
+	}
+	for id, sy := range p.Symbols {
+		if sy.Mem == nil {
+			continue
+		}
+		// os dados estão escritos como no fonte, e sem
+		// dados a memória começa zerada
+		data := unescape(sy.Mem.Data)
+		size := sy.Mem.Size
+		if int64(len(data)) >= size {
+			size = int64(len(data)) + 1
+		}
+		addr := m.alloc(size)
+		copy(m.Memory[addr>>32], data)
+		m.Decls[ir.SymbolID(id)] = addr
+	}
+	for _, sy := range M.Global.Symbols {
+		// veja linearization.globalLabel
+		m.Procs[M.Name+"_"+sy.Name] = sy
+	}
+	return m
+}
+
+func (this *machine) run() (int, *Error) {
+	defer this.Out.Flush()
+	rets, err := this.call(this.P.Entry, []int64{})
+	if err != nil {
+		return 1, err
+	}
+	return int(int32(rets[0])), nil
+}
+
+func (this *machine) call(id ir.SymbolID, args []int64) ([]int64, *Error) {
+	proc := this.P.Symbols[id].Proc
+	if this.Depth >= MaxDepth {
+		return nil, errorStackOverflow(this.M, this.Procs[proc.Label].N)
+	}
+	this.Depth++
+	defer func() { this.Depth-- }()
+
+	fr := &irFrame{
+		Proc: proc,
+		Args: args,
+		Vars: make([]int64, len(proc.Vars)),
+	}
+	b := proc.GetBlock(proc.Start)
+	for {
+		err := this.checkDeadline(proc)
+		if err != nil {
+			return nil, err
+		}
+		for _, in := range b.Code {
+			err := this.exec(fr, in)
+			if err != nil {
+				return nil, err
+			}
+		}
+		switch b.Out.V {
+		case FK.Jmp:
+			b = proc.GetBlock(b.Out.True)
+		case FK.If:
+			if this.value(fr, b.Out.Operands[0]) != 0 {
+				b = proc.GetBlock(b.Out.True)
+			} else {
+				b = proc.GetBlock(b.Out.False)
+			}
+		case FK.Return:
+			rets := []int64{}
+			for _, op := range b.Out.Operands {
+				rets = append(rets, this.value(fr, op))
+			}
+			return rets, nil
+		default:
+			panic("unreachable: bloco sem saida em " + proc.Label)
+		}
+	}
+}
+
+// o relogio só é consultado de vez em quando, ele é lento
+func (this *machine) checkDeadline(proc *ir.Procedure) *Error {
+	this.Steps++
+	if this.Deadline.IsZero() || this.Steps%1024 != 0 {
+		return nil
+	}
+	if time.Now().After(this.Deadline) {
+		return errorTimeout(this.M, this.Procs[proc.Label].N)
+	}
+	return nil
+}
+
+func (this *machine) exec(fr *irFrame, in ir.Instr) *Error {
+	switch in.T {
+	case IK.Add, IK.Sub, IK.Mult, IK.Div, IK.Rem:
+		a := this.value(fr, in.Operands[0])
+		b := this.value(fr, in.Operands[1])
+		res, ok := arithIR(in.T, in.Type, a, b)
+		if !ok {
+			// a divisão inteira passa antes por 'divisor',
+			// então isso só acontece se a linearização esqueceu
+			panic("unreachable: divisão por zero sem verificação")
+		}
+		this.write(fr, in.Destination[0], res)
+	case IK.Eq, IK.Diff, IK.Less, IK.More, IK.LessEq, IK.MoreEq:
+		a := this.value(fr, in.Operands[0])
+		b := this.value(fr, in.Operands[1])
+		this.write(fr, in.Destination[0], boolBits(compareIR(in.T, in.Type, a, b)))
+	case IK.Or:
+		a := this.value(fr, in.Operands[0])
+		b := this.value(fr, in.Operands[1])
+		this.write(fr, in.Destination[0], boolBits(a != 0 || b != 0))
+	case IK.And:
+		a := this.value(fr, in.Operands[0])
+		b := this.value(fr, in.Operands[1])
+		this.write(fr, in.Destination[0], boolBits(a != 0 && b != 0))
+	case IK.Not:
+		a := this.value(fr, in.Operands[0])
+		this.write(fr, in.Destination[0], boolBits(a == 0))
+	case IK.Neg:
+		a := this.value(fr, in.Operands[0])
+		if in.Type.Basic == irT.F64 {
+			this.write(fr, in.Destination[0], fromReal(-toReal(a)))
+		} else {
+			this.write(fr, in.Destination[0], wrapIR(-a, in.Type))
+		}
+	case IK.Convert:
+		op := in.Operands[0]
+		this.write(fr, in.Destination[0], convertIR(this.value(fr, op), op.Type, in.Type))
+	case IK.Copy:
+		this.write(fr, in.Destination[0], this.value(fr, in.Operands[0]))
+	case IK.LoadPtr:
+		addr := this.value(fr, in.Operands[0])
+		this.write(fr, in.Destination[0], this.load(addr, in.Type))
+	case IK.StorePtr:
+		v := this.value(fr, in.Operands[0])
+		addr := this.value(fr, in.Operands[1])
+		this.store(addr, in.Type, v)
+	case IK.Call:
+		return this.execCall(fr, in)
+	default:
+		panic("unreachable: instrução inesperada: " + in.String())
+	}
+	return nil
+}
+
+func (this *machine) execCall(fr *irFrame, in ir.Instr) *Error {
+	id := ir.SymbolID(in.Operands[0].ID)
+	args := []int64{}
+	for _, op := range in.Operands[1:] {
+		args = append(args, this.value(fr, op))
+	}
+	var rets []int64
+	var err *Error
+	sy := this.P.Symbols[id]
+	if sy.Builtin {
+		rets, err = this.callBuiltin(sy.Proc, args)
+	} else {
+		rets, err = this.call(id, args)
+	}
+	if err != nil {
+		return err
+	}
+	for i, dest := range in.Destination {
+		this.write(fr, dest, rets[i])
+	}
+	return nil
+}
+
+func (this *machine) value(fr *irFrame, op ir.Operand) int64 {
+	switch op.Class {
+	case irc.Lit:
+		return op.Num
+	case irc.Temp:
+		return fr.Temps[op.ID]
+	case irc.Arg:
+		return fr.Args[op.ID]
+	case irc.Local:
+		return fr.Vars[op.ID]
+	case irc.Global:
+		id := ir.SymbolID(op.ID)
+		if this.P.Symbols[id].Mem != nil {
+			return this.Decls[id]
+		}
+		return op.ID
+	}
+	panic("unreachable: operando inesperado: " + op.String())
+}
+
+func (this *machine) write(fr *irFrame, op ir.Operand, v int64) {
+	switch op.Class {
+	case irc.Temp:
+		for int64(len(fr.Temps)) <= op.ID {
+			fr.Temps = append(fr.Temps, 0)
+		}
+		fr.Temps[op.ID] = v
+		return
+	case irc.Arg:
+		fr.Args[op.ID] = v
+		return
+	case irc.Local:
+		fr.Vars[op.ID] = v
+		return
+	}
+	panic("unreachable: destino inesperado: " + op.String())
+}
+
+// memory ------------
+
+func (this *machine) alloc(size int64) int64 {
+	id := this.NextBlock
+	this.NextBlock++
+	this.Memory[id] = make([]byte, size)
+	return id << 32
+}
+
+// bytes retorna a memória que começa no endereço, com pelo menos size bytes
+func (this *machine) bytes(addr int64, size int64) []byte {
+	block, ok := this.Memory[addr>>32]
+	off := addr & 0xffffffff
+	if !ok || off+size > int64(len(block)) {
+		panic(fmt.Sprintf("unreachable: acesso invalido à memória: %x (%v bytes)", addr, size))
+	}
+	return block[off:]
+}
+
+func (this *machine) load(addr int64, t *irT.Type) int64 {
+	b := this.bytes(addr, sizeIR(t))
+	switch t.Basic {
+	case irT.I8:
+		return int64(int8(b[0]))
+	case irT.Bool:
+		return int64(b[0])
+	case irT.I16:
+		return int64(int16(binary.LittleEndian.Uint16(b)))
+	case irT.I32:
+		return int64(int32(binary.LittleEndian.Uint32(b)))
+	}
+	return int64(binary.LittleEndian.Uint64(b))
+}
+
+func (this *machine) store(addr int64, t *irT.Type, v int64) {
+	b := this.bytes(addr, sizeIR(t))
+	switch t.Basic {
+	case irT.I8, irT.Bool:
+		b[0] = byte(v)
+	case irT.I16:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+	case irT.I32:
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	default:
+		binary.LittleEndian.PutUint64(b, uint64(v))
+	}
+}
+
+// cadeia lê a cadeia terminada em zero do endereço,
+// o ponteiro nulo é a cadeia vazia
+func (this *machine) cadeia(addr int64) string {
+	if addr == 0 {
+		return ""
+	}
+	b := this.bytes(addr, 0)
+	end := 0
+	for end < len(b) && b[end] != 0 {
+		end++
+	}
+	return string(b[:end])
+}
+
+func (this *machine) newCadeia(s string) int64 {
+	addr := this.alloc(int64(len(s)) + 1)
+	copy(this.Memory[addr>>32], s)
+	return addr
+}
+
+func sizeIR(t *irT.Type) int64 {
+	switch t.Basic {
+	case irT.I8, irT.Bool:
+		return 1
+	case irT.I16:
+		return 2
+	case irT.I32:
+		return 4
+	}
+	return 8
+}
+
+// arithmetic ------------
+
+func arithIR(kind IK.InstrKind, t *irT.Type, a, b int64) (int64, bool) {
+	if t.Basic == irT.F64 {
+		x, y := toReal(a), toReal(b)
+		switch kind {
+		case IK.Add:
+			return fromReal(x + y), true
+		case IK.Sub:
+			return fromReal(x - y), true
+		case IK.Mult:
+			return fromReal(x * y), true
+		case IK.Div:
+			return fromReal(x / y), true
+		case IK.Rem:
+			return fromReal(math.Mod(x, y)), true
+		}
+	}
+	var res int64
+	switch kind {
+	case IK.Add:
+		res = a + b
+	case IK.Sub:
+		res = a - b
+	case IK.Mult:
+		res = a * b
+	case IK.Div:
+		if b == 0 {
+			return 0, false
+		}
+		res = a / b
+	case IK.Rem:
+		if b == 0 {
+			return 0, false
+		}
+		res = a % b
+	}
+	return wrapIR(res, t), true
+}
+
+func compareIR(kind IK.InstrKind, t *irT.Type, a, b int64) bool {
+	var cmp int
+	if t.Basic == irT.F64 {
+		cmp = compareReal(toReal(a), toReal(b))
+	} else {
+		cmp = compareInt(a, b)
+	}
+	switch kind {
+	case IK.Eq:
+		return cmp == 0
+	case IK.Diff:
+		return cmp != 0
+	case IK.Less:
+		return cmp < 0
+	case IK.More:
+		return cmp > 0
+	case IK.LessEq:
+		return cmp <= 0
+	case IK.MoreEq:
+		return cmp >= 0
+	}
+	panic("unreachable")
+}
+
+// convertIR segue as conversões de C, como convert
+func convertIR(v int64, from, to *irT.Type) int64 {
+	if from.Basic == to.Basic {
+		return v
+	}
+	if from.Basic == irT.F64 {
+		if to.Basic == irT.Bool {
+			return boolBits(toReal(v) != 0)
+		}
+		return wrapIR(int64(toReal(v)), to)
+	}
+	if to.Basic == irT.F64 {
+		return fromReal(float64(v))
+	}
+	return wrapIR(v, to)
+}
+
+// wrapIR trunca o valor pro tamanho do tipo
+func wrapIR(v int64, t *irT.Type) int64 {
+	switch t.Basic {
+	case irT.I8:
+		return int64(int8(v))
+	case irT.I16:
+		return int64(int16(v))
+	case irT.I32:
+		return int64(int32(v))
+	case irT.Bool:
+		return boolBits(v != 0)
+	}
+	return v
+}
+
+func boolBits(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func toReal(v int64) float64 {
+	return math.Float64frombits(uint64(v))
+}
+
+func fromReal(f float64) int64 {
+	return int64(math.Float64bits(f))
+}
+
+// builtins ------------
+
+// irBuiltin recebe os argumentos já nos tipos da assinatura
+type irBuiltin func(m *machine, args []int64) ([]int64, *Error)
+
+// os embutidos que só existem na representação intermediaria,
+// os da linguagem, como raiz e expo, usam a tabela 'builtins'
+var irBuiltins = map[string]irBuiltin{
+	"aloca":            irAloca,
+	"libera":           irLibera,
+	"zera":             irZera,
+	"copia":            irCopia,
+	"indice":           irIndice,
+	"divisor":          irDivisor,
+	"quociente":        irQuociente,
+	"resto":            irResto,
+	"compara_cadeia":   irComparaCadeia,
+	"imprima_mensagem": irImprimaMensagem,
+}
+
+func (this *machine) callBuiltin(proc *ir.Procedure, args []int64) ([]int64, *Error) {
+	if f, ok := irBuiltins[proc.Label]; ok {
+		return f(this, args)
+	}
+	if strings.HasPrefix(proc.Label, "leia_") {
+		return this.leia(proc.Rets[0], args[0])
+	}
+	if strings.HasPrefix(proc.Label, "imprima_") {
+		this.imprima(strings.TrimPrefix(proc.Label, "imprima_"), proc.Args[0], args[0])
+		return []int64{}, nil
+	}
+	f, ok := builtins[proc.Label]
+	if !ok {
+		panic("unreachable: embutido desconhecido: " + proc.Label)
+	}
+	x := []Value{}
+	for i, arg := range args {
+		x = append(x, toValue(arg, proc.Args[i]))
+	}
+	res, err := f(nil, nil, x)
+	if err != nil {
+		return nil, err
+	}
+	return []int64{fromValue(res, proc.Rets[0])}, nil
+}
+
+func toValue(v int64, t *irT.Type) Value {
+	if t.Basic == irT.F64 {
+		return Value{T: T.T_Real, Real: toReal(v)}
+	}
+	return Value{T: T.T_Inteiro, Int: v}
+}
+
+func fromValue(v *Value, t *irT.Type) int64 {
+	if t.Basic == irT.F64 {
+		if v.T.Basic == T.Real {
+			return fromReal(v.Real)
+		}
+		return fromReal(float64(v.Int))
+	}
+	if v.T.Basic == T.Real {
+		return wrapIR(int64(v.Real), t)
+	}
+	return wrapIR(v.Int, t)
+}
+
+func irAloca(m *machine, args []int64) ([]int64, *Error) {
+	return []int64{m.alloc(args[0])}, nil
+}
+
+func irLibera(m *machine, args []int64) ([]int64, *Error) {
+	delete(m.Memory, args[0]>>32)
+	return []int64{}, nil
+}
+
+func irZera(m *machine, args []int64) ([]int64, *Error) {
+	b := m.bytes(args[0], args[1])
+	for i := int64(0); i < args[1]; i++ {
+		b[i] = 0
+	}
+	return []int64{}, nil
+}
+
+func irCopia(m *machine, args []int64) ([]int64, *Error) {
+	dest := m.bytes(args[0], args[2])
+	src := m.bytes(args[1], args[2])
+	copy(dest[:args[2]], src[:args[2]])
+	return []int64{}, nil
+}
+
+// indice(i, tamanho, local, nome) e os outros que podem falhar
+// recebem o local do codigo fonte como texto, igual ao C gerado
+func irIndice(m *machine, args []int64) ([]int64, *Error) {
+	i, size := args[0], args[1]
+	if i < 0 || i >= size {
+		msg := fmt.Sprintf("indice %v fora dos limites do vetor '%v' de tamanho %v",
+			i, m.cadeia(args[3]), size)
+		return nil, errorRuntime(m, args[2], msg)
+	}
+	return []int64{i}, nil
+}
+
+func irDivisor(m *machine, args []int64) ([]int64, *Error) {
+	if args[0] == 0 {
+		return nil, errorRuntime(m, args[1], "divisão por zero")
+	}
+	return []int64{args[0]}, nil
+}
+
+func irQuociente(m *machine, args []int64) ([]int64, *Error) {
+	if args[1] == 0 {
+		return nil, errorRuntime(m, args[2], "divisão por zero")
+	}
+	return []int64{wrapIR(args[0]/args[1], irT.T_I32)}, nil
+}
+
+func irResto(m *machine, args []int64) ([]int64, *Error) {
+	if args[1] == 0 {
+		return nil, errorRuntime(m, args[2], "divisão por zero")
+	}
+	return []int64{args[0] % args[1]}, nil
+}
+
+// funciona como o strcmp do C
+func irComparaCadeia(m *machine, args []int64) ([]int64, *Error) {
+	a := truncate(m.cadeia(args[0]))
+	b := truncate(m.cadeia(args[1]))
+	return []int64{int64(strings.Compare(a, b))}, nil
+}
+
+func irImprimaMensagem(m *machine, args []int64) ([]int64, *Error) {
+	m.Out.WriteString(m.cadeia(args[0]))
+	return []int64{}, nil
+}
+
+// leia recebe o valor atual da variavel e retorna o novo,
+// igual ao scanf, se a entrada for invalida ele não muda
+func (this *machine) leia(t *irT.Type, old int64) ([]int64, *Error) {
+	switch t.Basic {
+	case irT.I32:
+		i, ok := readInt(this.In)
+		if ok {
+			return []int64{wrapIR(i, t)}, nil
+		}
+	case irT.I8:
+		b, err := this.In.ReadByte()
+		if err == nil {
+			return []int64{int64(int8(b))}, nil
+		}
+	case irT.F64:
+		r, ok := readReal(this.In)
+		if ok {
+			return []int64{fromReal(r)}, nil
+		}
+	case irT.Ptr:
+		s, ok := readLine(this.In)
+		if ok {
+			return []int64{this.newCadeia(s)}, nil
+		}
+	}
+	return []int64{old}, nil
+}
+
+func (this *machine) imprima(tipo string, t *irT.Type, v int64) {
+	switch tipo {
+	case "cadeia":
+		this.Out.WriteString(truncate(this.cadeia(v)))
+	case "logico":
+		if v != 0 {
+			this.Out.WriteString("verdadeiro")
+		} else {
+			this.Out.WriteString("falso")
+		}
+	case "caractere":
+		this.Out.WriteByte(byte(v))
+	case "real":
+		this.Out.WriteString(fmt.Sprintf("%f", toReal(v)))
+	default:
+		this.Out.WriteString(strconv.FormatInt(v, 10))
+	}
+}
+
+// errors -----------
+
+// errorRuntime mostra o erro no local passado pelo programa,
+// que é o texto de mod.Place, como no C gerado
+func errorRuntime(m *machine, local int64, msg string) *Error {
+	return &Error{
+		Code:     ek.RuntimeError,
+		Severity: sv.Error,
+		Location: parseLocal(m.M, m.cadeia(local)),
+		Message:  msg,
+	}
+}
+
+func parseLocal(M *mod.Module, local string) *Location {
+	text := strings.TrimPrefix(local, M.FullPath+":")
+	parts := strings.Split(text, " to ")
+	begin, ok := parsePosition(parts[0])
+	if !ok {
+		return &Location{File: local}
+	}
+	end := begin
+	if len(parts) == 2 {
+		end, ok = parsePosition(parts[1])
+		if !ok {
+			return &Location{File: local}
+		}
+	}
+	return &Location{
+		File:  M.FullPath,
+		Range: &Range{Begin: begin, End: end},
+	}
+}
+
+func parsePosition(s string) (Position, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return Position{}, false
+	}
+	line, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Position{}, false
+	}
+	col, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Position{}, false
+	}
+	return Position{Line: line, Column: col}, true
+}
@@ -11,6 +11,7 @@ import (
 
 	"fmt"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -60,6 +61,9 @@ type Lexer struct {
 	Input        string
 
 	Peeked *lx.Lexeme
+
+	// erros de sintaxe que o parser já recuperou
+	Errors ErrorList
 }
 
 func NewLexer(filename string, s string) *Lexer {
@@ -272,15 +276,41 @@ func any(st *Lexer) (*lx.Lexeme, *Error) {
 	}
 
 	switch r {
-	case '+':
+	case '+': // +  +=  ++
 		nextRune(st)
-		tp = T.Plus
-	case '-':
+		r = peekRune(st)
+		switch r {
+		case '=':
+			nextRune(st)
+			tp = T.PlusAssign
+		case '+':
+			nextRune(st)
+			tp = T.Increment
+		default:
+			tp = T.Plus
+		}
+	case '-': // -  -=  --
 		nextRune(st)
-		tp = T.Minus
-	case '*':
+		r = peekRune(st)
+		switch r {
+		case '=':
+			nextRune(st)
+			tp = T.MinusAssign
+		case '-':
+			nextRune(st)
+			tp = T.Decrement
+		default:
+			tp = T.Minus
+		}
+	case '*': // *  *=
 		nextRune(st)
-		tp = T.Star
+		r = peekRune(st)
+		if r == '=' {
+			nextRune(st)
+			tp = T.StarAssign
+		} else {
+			tp = T.Star
+		}
 	case '>': // >  >=
 		nextRune(st)
 		r = peekRune(st)
@@ -333,11 +363,24 @@ func any(st *Lexer) (*lx.Lexeme, *Error) {
 			nextRune(st)
 			blockComment(st)
 			return any(st)
+		} else if r == '=' {
+			nextRune(st)
+			tp = T.DivisionAssign
+		} else {
+			tp = T.Division
 		}
-		tp = T.Division
-	case '%':
+	case '^':
 		nextRune(st)
-		tp = T.Remainder
+		tp = T.Caret
+	case '%': // %  %=
+		nextRune(st)
+		r = peekRune(st)
+		if r == '=' {
+			nextRune(st)
+			tp = T.RemainderAssign
+		} else {
+			tp = T.Remainder
+		}
 	case '(':
 		nextRune(st)
 		tp = T.LeftParen
@@ -350,9 +393,24 @@ func any(st *Lexer) (*lx.Lexeme, *Error) {
 	case '}':
 		nextRune(st)
 		tp = T.RightBrace
+	case '[':
+		nextRune(st)
+		tp = T.LeftBracket
+	case ']':
+		nextRune(st)
+		tp = T.RightBracket
 	case ',':
 		nextRune(st)
 		tp = T.Comma
+	case ':':
+		nextRune(st)
+		tp = T.Colon
+	case '.':
+		nextRune(st)
+		tp = T.Dot
+	case '&':
+		nextRune(st)
+		tp = T.Ampersand
 	case ';':
 		nextRune(st)
 		tp = T.Semicolon
@@ -362,11 +420,61 @@ func any(st *Lexer) (*lx.Lexeme, *Error) {
 	default:
 		message := fmt.Sprintf("simbolo invalido: %v", string(r))
 		err := NewLexerError(st, et.InvalidSymbol, message)
+		if unicode.IsLetter(r) {
+			err.Hint = accentHint(st)
+		}
 		return nil, err
 	}
 	return genNode(st, tp), nil
 }
 
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a",
+	"é", "e", "ê", "e", "í", "i",
+	"ó", "o", "ô", "o", "õ", "o", "ú", "u", "ç", "c",
+	"Á", "A", "À", "A", "Â", "A", "Ã", "A",
+	"É", "E", "Ê", "E", "Í", "I",
+	"Ó", "O", "Ô", "O", "Õ", "O", "Ú", "U", "Ç", "C",
+)
+
+// accentHint sugere a palavra sem acentos quando uma letra
+// acentuada aparece no meio de um nome, como em 'senão'.
+// A palavra inteira é recuperada olhando em volta da letra invalida
+func accentHint(st *Lexer) string {
+	begin := st.End
+	for begin > 0 && strings.IndexByte(digits+letters, st.Input[begin-1]) >= 0 {
+		begin--
+	}
+	end := st.End
+	for end < len(st.Input) {
+		r, size := utf8.DecodeRuneInString(st.Input[end:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		end += size
+	}
+	word := accents.Replace(st.Input[begin:end])
+	if !isIdentifier(word) {
+		return ""
+	}
+	if _, ok := keywords[word]; ok {
+		return "você quis dizer '" + word + "'? palavras chave não têm acento"
+	}
+	return "nomes não podem ter acento, tente '" + word + "'"
+}
+
+func isIdentifier(word string) bool {
+	if word == "" || !isLetter(rune(word[0])) {
+		return false
+	}
+	for _, r := range word {
+		if !isLetter(r) && !isNumber(r) {
+			return false
+		}
+	}
+	return true
+}
+
 // sorry
 func number(st *Lexer) *lx.Lexeme {
 	r := peekRune(st)
@@ -406,41 +514,64 @@ func number(st *Lexer) *lx.Lexeme {
 	return genNumNode(st, T.IntLit, value)
 }
 
+// keywords são as palavras reservadas da linguagem
+var keywords = map[string]T.LexKind{
+	"retorne":    T.Retorne,
+	"para":       T.Para,
+	"de":         T.De,
+	"ate":        T.Ate,
+	"passo":      T.Passo,
+	"enquanto":   T.Enquanto,
+	"se":         T.Se,
+	"senao":      T.Senao,
+	"real":       T.Real,
+	"inteiro":    T.Inteiro,
+	"caractere":  T.Caractere,
+	"cadeia":     T.Cadeia,
+	"logico":     T.Logico,
+	"verdadeiro": T.Verdadeiro,
+	"falso":      T.Falso,
+	"constante":  T.Constante,
+	"registro":   T.Registro,
+	"faca":       T.Faca,
+	"escolha":    T.Escolha,
+	"caso":       T.Caso,
+	"outrocaso":  T.Outrocaso,
+	"pare":       T.Pare,
+	"continue":   T.Continue,
+	"vazio":      T.Vazio,
+	"imprima":    T.Imprima,
+	"leia":       T.Leia,
+	"ou":         T.Ou,
+	"e":          T.E,
+	"nao":        T.Nao,
+}
+
+// Keywords retorna as palavras chave, usadas pra sugerir
+// correções de nomes escritos errado
+func Keywords() []string {
+	out := make([]string, 0, len(keywords))
+	for kw := range keywords {
+		out = append(out, kw)
+	}
+	return out
+}
+
+// IsKeyword diz se a palavra é reservada
+func IsKeyword(word string) bool {
+	_, ok := keywords[word]
+	return ok
+}
+
 func identifier(st *Lexer) *lx.Lexeme {
 	r := peekRune(st)
 	if !isLetter(r) {
 		panic("identifier not beginning with letter")
 	}
 	acceptRun(st, digits+letters)
-	selected := st.Selected()
-	tp := T.Ident
-	switch selected {
-	case "retorne":
-		tp = T.Retorne
-	case "para":
-		tp = T.Para
-	case "enquanto":
-		tp = T.Enquanto
-	case "se":
-		tp = T.Se
-	case "senao":
-		tp = T.Senao
-	case "real":
-		tp = T.Real
-	case "inteiro":
-		tp = T.Inteiro
-	case "caractere":
-		tp = T.Caractere
-	case "imprima":
-		tp = T.Imprima
-	case "leia":
-		tp = T.Leia
-	case "ou":
-		tp = T.Ou
-	case "e":
-		tp = T.E
-	case "nao":
-		tp = T.Nao
+	tp, ok := keywords[st.Selected()]
+	if !ok {
+		tp = T.Ident
 	}
 	return genNode(st, tp)
 }
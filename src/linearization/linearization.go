@@ -2,7 +2,19 @@ package linearization
 
 import (
 	ir "github.com/padeir0/pir"
+	irc "github.com/padeir0/pir/class"
+	IK "github.com/padeir0/pir/instrkind"
+	irT "github.com/padeir0/pir/types"
+
 	mod "upt/core/module"
+	T "upt/core/types"
+
+	lk "upt/core/lexeme/lexkind"
+	nk "upt/core/module/nodekind"
+	sk "upt/core/module/symbolkind"
+
+	"fmt"
+	"math"
 )
 
 type scopedSymbol struct {
@@ -16,29 +28,1335 @@ type context struct {
 	Sy *mod.Symbol
 
 	GlobalMap map[string]ir.SymbolID
-	LocalMap  map[scopedSymbol]ir.Operand
+	LocalMap  map[scopedSymbol]place
+	// locais passadas por referencia em algum lugar do procedimento
+	Addressed map[scopedSymbol]bool
+
+	// leia e imprima viram chamadas a esses procedimentos
+	BuiltinMap map[string]ir.SymbolID
+
+	Proc        *ir.Procedure
+	CurrBlock   *ir.BasicBlock
+	TempCounter int64
+
+	// destinos de 'pare' e 'continue', o ultimo é o laço mais interno
+	Loops []loop
+
+	// todo 'retorne' guarda o valor em RetVal e pula pro
+	// Epilogue, que libera a memória alocada pelo procedimento
+	Epilogue ir.BlockID
+	RetVal   ir.Operand
+	Memory   []memory
+}
+
+// memory é um bloco alocado na entrada do procedimento,
+// Slot é a local que guarda o endereço. Se Arg não for nil,
+// o argumento é guardado na memória logo depois da alocação
+type memory struct {
+	Slot ir.Operand
+	T    *T.Type
+	Arg  *ir.Operand
+}
+
+type loop struct {
+	Break    ir.BlockID
+	Continue ir.BlockID
+}
+
+func (this *context) pushLoop(brk, cont ir.BlockID) {
+	this.Loops = append(this.Loops, loop{Break: brk, Continue: cont})
+}
+
+func (this *context) popLoop() {
+	this.Loops = this.Loops[:len(this.Loops)-1]
 }
 
 func newCtx(M *mod.Module) *context {
 	p := ir.NewProgram()
 	p.Name = M.Name
 	return &context{
-		M:         M,
-		P:         p,
-		Sy:        nil,
-		GlobalMap: map[string]ir.SymbolID{},
-		LocalMap:  map[scopedSymbol]ir.Operand{},
+		M:          M,
+		P:          p,
+		Sy:         nil,
+		GlobalMap:  map[string]ir.SymbolID{},
+		LocalMap:   map[scopedSymbol]place{},
+		Addressed:  map[scopedSymbol]bool{},
+		BuiltinMap: map[string]ir.SymbolID{},
 	}
 }
 
 func Linearize(m *mod.Module) *ir.Program {
 	ctx := newCtx(m)
+	// os procedimentos e as globais precisam ser declarados antes
+	// pra que qualquer procedimento possa referenciar eles.
+	// Constantes são substituidas pelo valor onde aparecem,
+	// e tipos não geram código
+	for _, sy := range ctx.M.Global.Symbols {
+		switch sy.Kind {
+		case sk.Procedure:
+			declareFunc(ctx, sy)
+		case sk.Global:
+			declareGlobal(ctx, sy)
+		}
+	}
 	for _, sy := range ctx.M.Global.Symbols {
-		lnFunc(ctx, sy)
+		if sy.Kind == sk.Procedure {
+			lnFunc(ctx, sy)
+		}
 	}
+	ctx.P.Entry = ctx.GlobalMap["entrada"]
 	return ctx.P
 }
 
+// globais moram na memória, e sem dados a memória começa zerada,
+// como as globais do C
+func declareGlobal(ctx *context, sy *mod.Symbol) {
+	ctx.GlobalMap[sy.Name] = ctx.P.AddMem(&ir.MemoryDecl{
+		Label: globalLabel(ctx.M, sy),
+		Size:  sizeOf(sy.Type),
+		Data:  "",
+	})
+}
+
+func declareFunc(ctx *context, sy *mod.Symbol) {
+	args := []*irT.Type{}
+	for _, arg := range sy.Args {
+		args = append(args, argToIrType(arg))
+	}
+	// registros retornados são escritos na memória de quem chamou,
+	// que passa o endereço como um argumento a mais no final
+	if T.IsRecord(sy.Type.Proc.Ret) {
+		args = append(args, irT.T_Ptr)
+	}
+	proc := &ir.Procedure{
+		Label:     globalLabel(ctx.M, sy),
+		Args:      args,
+		Rets:      retsToIr(sy.Type.Proc.Ret),
+		Vars:      []*irT.Type{},
+		AllBlocks: []*ir.BasicBlock{},
+	}
+	ctx.GlobalMap[sy.Name] = ctx.P.AddProc(proc)
+}
+
 func lnFunc(ctx *context, sy *mod.Symbol) {
-	panic("unimplemented")
+	// precisamos resetar isso pra cada função
+	ctx.LocalMap = map[scopedSymbol]place{}
+	ctx.Addressed = map[scopedSymbol]bool{}
+	ctx.TempCounter = 0
+	ctx.Memory = []memory{}
+	ctx.Sy = sy
+	ctx.Proc = ctx.P.Symbols[ctx.GlobalMap[sy.Name]].Proc
+
+	scope := sy.N.Scope
+	findAddressed(ctx, scope, sy.N.Leaves[3])
+	for _, arg := range sy.Args {
+		ss := scopedSymbol{ScopeID: scope.ID, Name: arg.Name}
+		op := ir.Operand{
+			Class: irc.Arg,
+			Type:  argToIrType(arg),
+			ID:    int64(arg.Pos),
+		}
+		switch {
+		case arg.Ref:
+			// o argumento já é o endereço da variavel de quem chamou
+			ctx.LocalMap[ss] = place{Op: op, InMemory: true, T: arg.T}
+		case ctx.Addressed[ss] || T.IsRecord(arg.T):
+			// registros passados por valor são copiados, assim
+			// o procedimento pode modificar a copia à vontade
+			slot := allocMemory(ctx, arg.T)
+			ctx.Memory[len(ctx.Memory)-1].Arg = &op
+			ctx.LocalMap[ss] = place{Op: slot, InMemory: true, T: arg.T}
+		default:
+			ctx.LocalMap[ss] = place{Op: op, T: arg.T}
+		}
+	}
+
+	// o prologo aloca a memória das locais, mas só sabemos
+	// quais são depois de percorrer o corpo do procedimento
+	prologue := ctx.Proc.NewBlock()
+	ctx.Proc.Start = prologue
+	body := ctx.Proc.NewBlock()
+	ctx.Epilogue = ctx.Proc.NewBlock()
+	ret := sy.Type.Proc.Ret
+	if !T.IsVoid(ret) {
+		ctx.RetVal = newLocal(ctx, typeToIrType(ret))
+	}
+	ctx.CurrBlock = ctx.Proc.GetBlock(body)
+
+	bl := sy.N.Leaves[3]
+	lnBlock(ctx, scope, bl)
+
+	// o procedimento pode terminar sem 'retorne',
+	// nesse caso retornamos o valor zero do tipo
+	if !T.IsVoid(ret) {
+		copyTo(ctx, zeroOf(ret), ctx.RetVal)
+	}
+	ctx.CurrBlock.Jmp(ctx.Epilogue)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(prologue)
+	for _, m := range ctx.Memory {
+		aloca := builtin(ctx, "aloca", irT.T_I64, irT.T_Ptr)
+		size := ir.Operand{Class: irc.Lit, Type: irT.T_I64, Num: sizeOf(m.T)}
+		callBuiltin(ctx, aloca, []ir.Operand{size}, []ir.Operand{m.Slot})
+		if m.Arg != nil {
+			storeValue(ctx, *m.Arg, m.Slot, m.T)
+		}
+	}
+	ctx.CurrBlock.Jmp(body)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(ctx.Epilogue)
+	for _, m := range ctx.Memory {
+		libera := builtin(ctx, "libera", irT.T_Ptr, nil)
+		callBuiltin(ctx, libera, []ir.Operand{m.Slot}, []ir.Operand{})
+	}
+	if T.IsVoid(ret) {
+		ctx.CurrBlock.Return([]ir.Operand{})
+	} else {
+		ctx.CurrBlock.Return([]ir.Operand{ctx.RetVal})
+	}
+}
+
+func lnBlock(ctx *context, scope *mod.Scope, bl *mod.Node) {
+	scope = bl.Scope
+	for _, cmd := range bl.Leaves {
+		lnCmd(ctx, scope, cmd)
+	}
+}
+
+func lnCmd(ctx *context, scope *mod.Scope, n *mod.Node) {
+	switch n.Kind {
+	case nk.Terminal:
+		switch n.Lexeme.Kind {
+		case lk.Leia:
+			lnLeia(ctx, scope, n)
+			return
+		case lk.Imprima:
+			lnImprima(ctx, scope, n)
+			return
+		case lk.Se:
+			lnSe(ctx, scope, n)
+			return
+		case lk.Enquanto:
+			lnEnquanto(ctx, scope, n)
+			return
+		case lk.Faca:
+			lnFaca(ctx, scope, n)
+			return
+		case lk.Escolha:
+			lnEscolha(ctx, scope, n)
+			return
+		case lk.Para:
+			lnPara(ctx, scope, n)
+			return
+		case lk.Retorne:
+			lnRetorne(ctx, scope, n)
+			return
+		case lk.Pare, lk.Continue:
+			lnSalto(ctx, n)
+			return
+		case lk.Assign:
+			lnAtrib(ctx, scope, n)
+			return
+		}
+	case nk.CountedLoop:
+		lnParaDe(ctx, scope, n)
+		return
+	case nk.Block:
+		lnBlock(ctx, scope, n)
+		return
+	case nk.VarDecl:
+		lnVarDecl(ctx, scope, n)
+		return
+	}
+	lnExpr(ctx, scope, n)
+}
+
+func lnLeia(ctx *context, scope *mod.Scope, n *mod.Node) {
+	alvo := n.Leaves[0]
+	dest := findPlace(ctx, scope, alvo)
+	t := typeToIrType(alvo.T)
+	// como o scanf, o embutido recebe o valor atual
+	// e devolve ele se a entrada for invalida
+	proc := builtin(ctx, "leia_"+alvo.T.String(), t, t)
+	res := newTemp(ctx, t)
+	callBuiltin(ctx, proc, []ir.Operand{readPlace(ctx, dest)}, []ir.Operand{res})
+	writePlace(ctx, dest, res)
+}
+
+func lnImprima(ctx *context, scope *mod.Scope, n *mod.Node) {
+	arg := n.Leaves[0]
+	if arg.Lexeme != nil && arg.Lexeme.Kind == lk.StringLit {
+		mem := newMessage(ctx, arg.Lexeme.Text)
+		proc := builtin(ctx, "imprima_mensagem", irT.T_Ptr, nil)
+		callBuiltin(ctx, proc, []ir.Operand{mem}, []ir.Operand{})
+		return
+	}
+	op := lnExpr(ctx, scope, arg)
+	proc := builtin(ctx, "imprima_"+arg.T.String(), op.Type, nil)
+	callBuiltin(ctx, proc, []ir.Operand{op}, []ir.Operand{})
+}
+
+func lnSe(ctx *context, scope *mod.Scope, n *mod.Node) {
+	// se := {cond, block, senao}
+	cond := lnCond(ctx, scope, n.Leaves[0])
+	trueID := ctx.Proc.NewBlock()
+	exitID := ctx.Proc.NewBlock()
+	falseID := exitID
+	sn := n.Leaves[2]
+	if sn != nil {
+		falseID = ctx.Proc.NewBlock()
+	}
+	ctx.CurrBlock.Branch(cond, trueID, falseID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(trueID)
+	lnBlock(ctx, scope, n.Leaves[1])
+	ctx.CurrBlock.Jmp(exitID)
+
+	if sn != nil {
+		ctx.CurrBlock = ctx.Proc.GetBlock(falseID)
+		lnBlock(ctx, scope, sn)
+		ctx.CurrBlock.Jmp(exitID)
+	}
+	ctx.CurrBlock = ctx.Proc.GetBlock(exitID)
+}
+
+func lnEnquanto(ctx *context, scope *mod.Scope, n *mod.Node) {
+	// enquanto := {cond, block}
+	condID := ctx.Proc.NewBlock()
+	bodyID := ctx.Proc.NewBlock()
+	exitID := ctx.Proc.NewBlock()
+	ctx.CurrBlock.Jmp(condID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(condID)
+	cond := lnCond(ctx, scope, n.Leaves[0])
+	ctx.CurrBlock.Branch(cond, bodyID, exitID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(bodyID)
+	ctx.pushLoop(exitID, condID)
+	lnBlock(ctx, scope, n.Leaves[1])
+	ctx.popLoop()
+	ctx.CurrBlock.Jmp(condID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(exitID)
+}
+
+func lnFaca(ctx *context, scope *mod.Scope, n *mod.Node) {
+	// faca := {block, cond}
+	bodyID := ctx.Proc.NewBlock()
+	condID := ctx.Proc.NewBlock()
+	exitID := ctx.Proc.NewBlock()
+	ctx.CurrBlock.Jmp(bodyID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(bodyID)
+	ctx.pushLoop(exitID, condID)
+	lnBlock(ctx, scope, n.Leaves[0])
+	ctx.popLoop()
+	ctx.CurrBlock.Jmp(condID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(condID)
+	cond := lnCond(ctx, scope, n.Leaves[1])
+	ctx.CurrBlock.Branch(cond, bodyID, exitID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(exitID)
+}
+
+// escolha vira uma sequencia de comparações,
+// cada caso testa seus rotulos e pula pro proximo se nenhum bater
+func lnEscolha(ctx *context, scope *mod.Scope, n *mod.Node) {
+	// escolha := {expr, caso...}
+	t := typeToIrType(n.Leaves[0].T)
+	subject := newLocal(ctx, t)
+	copyTo(ctx, lnExpr(ctx, scope, n.Leaves[0]), subject)
+	exitID := ctx.Proc.NewBlock()
+	for _, c := range n.Leaves[1:] {
+		// caso := {labels, block}
+		// outrocaso := {block}
+		bodyID := ctx.Proc.NewBlock()
+		nextID := ctx.Proc.NewBlock()
+		if c.Lexeme.Kind == lk.Caso {
+			for _, label := range c.Leaves[0].Leaves {
+				lit := ir.Operand{
+					Class: irc.Lit,
+					Type:  t,
+					Num:   label.Value.(int64),
+				}
+				res := newTemp(ctx, irT.T_Bool)
+				instr(ctx, opToInstr(lk.Equals), t, []ir.Operand{subject, lit}, res)
+				testID := ctx.Proc.NewBlock()
+				ctx.CurrBlock.Branch(res, bodyID, testID)
+				ctx.CurrBlock = ctx.Proc.GetBlock(testID)
+			}
+			ctx.CurrBlock.Jmp(nextID)
+		} else {
+			ctx.CurrBlock.Jmp(bodyID)
+		}
+
+		ctx.CurrBlock = ctx.Proc.GetBlock(bodyID)
+		lnBlock(ctx, scope, c.Leaves[len(c.Leaves)-1])
+		ctx.CurrBlock.Jmp(exitID)
+
+		ctx.CurrBlock = ctx.Proc.GetBlock(nextID)
+	}
+	ctx.CurrBlock.Jmp(exitID)
+	ctx.CurrBlock = ctx.Proc.GetBlock(exitID)
+}
+
+func lnPara(ctx *context, scope *mod.Scope, n *mod.Node) {
+	// para := {atrib, cond, atrib, block}
+	if n.Leaves[0] != nil {
+		lnAtrib(ctx, scope, n.Leaves[0])
+	}
+	condID := ctx.Proc.NewBlock()
+	bodyID := ctx.Proc.NewBlock()
+	stepID := ctx.Proc.NewBlock()
+	exitID := ctx.Proc.NewBlock()
+	ctx.CurrBlock.Jmp(condID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(condID)
+	cond := lnCond(ctx, scope, n.Leaves[1])
+	ctx.CurrBlock.Branch(cond, bodyID, exitID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(bodyID)
+	ctx.pushLoop(exitID, stepID)
+	lnBlock(ctx, scope, n.Leaves[3])
+	ctx.popLoop()
+	ctx.CurrBlock.Jmp(stepID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(stepID)
+	lnAtrib(ctx, scope, n.Leaves[2])
+	ctx.CurrBlock.Jmp(condID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(exitID)
+}
+
+func lnParaDe(ctx *context, scope *mod.Scope, n *mod.Node) {
+	// paraDe := {id, inicio, fim, passo, block}
+	i := findPlace(ctx, scope, n.Leaves[0])
+	t := typeToIrType(i.T)
+	writePlace(ctx, i, convert(ctx, lnExpr(ctx, scope, n.Leaves[1]), t))
+	fim := newLocal(ctx, t)
+	copyTo(ctx, convert(ctx, lnExpr(ctx, scope, n.Leaves[2]), t), fim)
+
+	var passo ir.Operand
+	if n.Value != nil {
+		passo = ir.Operand{Class: irc.Lit, Type: t, Num: n.Value.(int64)}
+	} else {
+		passo = newLocal(ctx, t)
+		copyTo(ctx, convert(ctx, lnExpr(ctx, scope, n.Leaves[3]), t), passo)
+	}
+
+	condID := ctx.Proc.NewBlock()
+	bodyID := ctx.Proc.NewBlock()
+	stepID := ctx.Proc.NewBlock()
+	exitID := ctx.Proc.NewBlock()
+	ctx.CurrBlock.Jmp(condID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(condID)
+	if n.Value != nil {
+		cmp := lk.LessOrEquals
+		if n.Value.(int64) < 0 {
+			cmp = lk.GreaterOrEquals
+		}
+		res := newTemp(ctx, irT.T_Bool)
+		instr(ctx, opToInstr(cmp), t, []ir.Operand{readPlace(ctx, i), fim}, res)
+		ctx.CurrBlock.Branch(res, bodyID, exitID)
+	} else {
+		// o sentido da comparação depende do sinal do passo
+		upID := ctx.Proc.NewBlock()
+		downID := ctx.Proc.NewBlock()
+		zero := ir.Operand{Class: irc.Lit, Type: t, Num: 0}
+		positive := newTemp(ctx, irT.T_Bool)
+		instr(ctx, opToInstr(lk.Greater), t, []ir.Operand{passo, zero}, positive)
+		ctx.CurrBlock.Branch(positive, upID, downID)
+
+		ctx.CurrBlock = ctx.Proc.GetBlock(upID)
+		up := newTemp(ctx, irT.T_Bool)
+		instr(ctx, opToInstr(lk.LessOrEquals), t, []ir.Operand{readPlace(ctx, i), fim}, up)
+		ctx.CurrBlock.Branch(up, bodyID, exitID)
+
+		ctx.CurrBlock = ctx.Proc.GetBlock(downID)
+		down := newTemp(ctx, irT.T_Bool)
+		instr(ctx, opToInstr(lk.GreaterOrEquals), t, []ir.Operand{readPlace(ctx, i), fim}, down)
+		ctx.CurrBlock.Branch(down, bodyID, exitID)
+	}
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(bodyID)
+	ctx.pushLoop(exitID, stepID)
+	lnBlock(ctx, scope, n.Leaves[4])
+	ctx.popLoop()
+	ctx.CurrBlock.Jmp(stepID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(stepID)
+	next := newTemp(ctx, t)
+	instr(ctx, opToInstr(lk.Plus), t, []ir.Operand{readPlace(ctx, i), passo}, next)
+	writePlace(ctx, i, next)
+	ctx.CurrBlock.Jmp(condID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(exitID)
+}
+
+func lnSalto(ctx *context, n *mod.Node) {
+	l := ctx.Loops[len(ctx.Loops)-1]
+	if n.Lexeme.Kind == lk.Pare {
+		ctx.CurrBlock.Jmp(l.Break)
+	} else {
+		ctx.CurrBlock.Jmp(l.Continue)
+	}
+	unreachable := ctx.Proc.NewBlock()
+	ctx.CurrBlock = ctx.Proc.GetBlock(unreachable)
+}
+
+// retorne := {expr} | {nil}, sem expressão nos procedimentos vazios
+func lnRetorne(ctx *context, scope *mod.Scope, n *mod.Node) {
+	ret := ctx.Sy.Type.Proc.Ret
+	if n.Leaves[0] != nil {
+		op := lnExpr(ctx, scope, n.Leaves[0])
+		op = convert(ctx, op, typeToIrType(ret))
+		if T.IsRecord(ret) {
+			// veja declareFunc, o destino é o ultimo argumento
+			dest := ir.Operand{
+				Class: irc.Arg,
+				Type:  irT.T_Ptr,
+				ID:    int64(len(ctx.Sy.Args)),
+			}
+			storeValue(ctx, op, dest, ret)
+			op = dest
+		}
+		copyTo(ctx, op, ctx.RetVal)
+	}
+	ctx.CurrBlock.Jmp(ctx.Epilogue)
+
+	// qualquer comando depois do retorne é inalcançavel,
+	// mas ainda precisa de um bloco pra ser emitido
+	unreachable := ctx.Proc.NewBlock()
+	ctx.CurrBlock = ctx.Proc.GetBlock(unreachable)
+}
+
+func lnAtrib(ctx *context, scope *mod.Scope, n *mod.Node) {
+	dest := findPlace(ctx, scope, n.Leaves[0])
+	var op ir.Operand
+	if mod.IsCompound(n) {
+		// o lado esquerdo da operação é o proprio alvo,
+		// que já foi calculado
+		bin := n.Leaves[1]
+		a := readPlace(ctx, dest)
+		b := lnExpr(ctx, scope, bin.Leaves[1])
+		op = binOp(ctx, bin, a, b)
+	} else {
+		op = lnExpr(ctx, scope, n.Leaves[1])
+	}
+	op = convert(ctx, op, typeToIrType(dest.T))
+	writePlace(ctx, dest, op)
+}
+
+func lnVarDecl(ctx *context, scope *mod.Scope, n *mod.Node) {
+	// vardecl := {type, id...}
+	// cada identificador tem o seu tipo, 'inteiro v[3], i' declara
+	// um vetor e um inteiro
+	for _, id := range n.Leaves[1:] {
+		ss := scopedSymbol{ScopeID: scope.ID, Name: id.Lexeme.Text}
+		if !T.IsValue(id.T) || ctx.Addressed[ss] {
+			slot := newMemory(ctx, id.T)
+			ctx.LocalMap[ss] = place{Op: slot, InMemory: true, T: id.T}
+			continue
+		}
+		local := newLocal(ctx, typeToIrType(id.T))
+		ctx.LocalMap[ss] = place{Op: local, T: id.T}
+		// cadeias começam vazias, e o ponteiro nulo é a cadeia vazia
+		if T.IsString(id.T) {
+			copyTo(ctx, zeroOf(id.T), local)
+		}
+	}
+}
+
+// lnCond gera o teste de uma expressão condicional,
+// que na linguagem fonte é um logico (ou um inteiro, com -compat),
+// e retorna um operando booleano
+func lnCond(ctx *context, scope *mod.Scope, n *mod.Node) ir.Operand {
+	if n.Kind == nk.Terminal && isComparison(n.Lexeme.Kind) {
+		return lnCompare(ctx, scope, n)
+	}
+	op := lnExpr(ctx, scope, n)
+	return toBool(ctx, op)
+}
+
+func lnExpr(ctx *context, scope *mod.Scope, n *mod.Node) ir.Operand {
+	switch n.Kind {
+	case nk.Terminal:
+		switch n.Lexeme.Kind {
+		case lk.Ou, lk.E:
+			return lnShortCircuit(ctx, scope, n)
+		case lk.Equals, lk.Different,
+			lk.Greater, lk.GreaterOrEquals, lk.Less, lk.LessOrEquals:
+			res := lnCompare(ctx, scope, n)
+			return convert(ctx, res, typeToIrType(n.T))
+		case lk.Plus, lk.Star, lk.Division, lk.Remainder:
+			return lnBinExpr(ctx, scope, n)
+		case lk.Caret:
+			return lnPotencia(ctx, scope, n)
+		case lk.Nao:
+			op := lnExpr(ctx, scope, n.Leaves[0])
+			b := toBool(ctx, op)
+			res := newTemp(ctx, irT.T_Bool)
+			instr(ctx, IK.Not, irT.T_Bool, []ir.Operand{b}, res)
+			return convert(ctx, res, typeToIrType(n.T))
+		case lk.Minus:
+			if len(n.Leaves) == 1 {
+				t := typeToIrType(n.T)
+				op := lnExpr(ctx, scope, n.Leaves[0])
+				op = convert(ctx, op, t)
+				res := newTemp(ctx, t)
+				instr(ctx, IK.Neg, t, []ir.Operand{op}, res)
+				return res
+			}
+			return lnBinExpr(ctx, scope, n)
+		case lk.IntLit, lk.RealLit, lk.CharLit,
+			lk.Verdadeiro, lk.Falso:
+			return litToOperand(n)
+		case lk.StringLit:
+			return newMessage(ctx, n.Lexeme.Text)
+		case lk.Ident:
+			name := n.Lexeme.Text
+			sy := scope.Find(name)
+			switch sy.Kind {
+			case sk.Local, sk.Argument, sk.Global:
+				return readPlace(ctx, findPlace(ctx, scope, n))
+			case sk.Constant:
+				return constToOperand(ctx, sy)
+			case sk.Procedure:
+				if sy.Builtin {
+					t := procToIrType(sy.Type)
+					if divisionBuiltins[sy.Name] {
+						// veja lnCall
+						t.Proc.Args = append(t.Proc.Args, irT.T_Ptr)
+					}
+					return declareBuiltin(ctx, sy.Name, t)
+				}
+				// o tipo vem da declaração, que sabe
+				// quais argumentos são por referencia
+				id := ctx.GlobalMap[name]
+				proc := ctx.P.Symbols[id].Proc
+				return ir.Operand{
+					Class: irc.Global,
+					Type:  &irT.Type{Proc: &irT.ProcType{Args: proc.Args, Rets: proc.Rets}},
+					ID:    int64(id),
+				}
+			}
+			panic("unreachable: simbolo inesperado: " + sy.String())
+		}
+	case nk.Call:
+		return lnCall(ctx, scope, n)
+	case nk.Index, nk.Field:
+		return readPlace(ctx, findPlace(ctx, scope, n))
+	}
+	panic("unreachable: expressão inesperada: " + n.String())
+}
+
+func lnCall(ctx *context, scope *mod.Scope, n *mod.Node) ir.Operand {
+	proc := n.Leaves[0]
+	procOp := lnExpr(ctx, scope, proc)
+	tArgs := proc.T.Proc.Args
+	sy := scope.Find(proc.Lexeme.Text)
+
+	ops := []ir.Operand{procOp}
+	args := n.Leaves[1]
+	for i, expr := range args.Leaves {
+		if isRefArg(sy, i) {
+			// a variavel está na memória, veja findAddressed
+			ops = append(ops, findPlace(ctx, scope, expr).Op)
+			continue
+		}
+		op := lnExpr(ctx, scope, expr)
+		op = convert(ctx, op, typeToIrType(tArgs[i]))
+		ops = append(ops, op)
+	}
+	if sy.Builtin && divisionBuiltins[sy.Name] {
+		ops = append(ops, newCadeia(ctx, mod.Place(ctx.M, n).String()))
+	}
+	// chamadas a procedimentos vazios não tem destino,
+	// e só aparecem como comandos, onde o operando é descartado
+	if T.IsVoid(n.T) {
+		callBuiltin(ctx, procOp, ops[1:], []ir.Operand{})
+		return ir.Operand{}
+	}
+	// cada chamada que retorna um registro tem a sua propria
+	// memória pro resultado, veja declareFunc
+	if T.IsRecord(n.T) {
+		ops = append(ops, allocMemory(ctx, n.T))
+	}
+	res := newTemp(ctx, typeToIrType(n.T))
+	instr(ctx, IK.Call, procOp.Type, ops, res)
+	return res
+}
+
+// os dois lados da expressão são convertidos pro tipo
+// do resultado, como definido em T.ConversionTable
+func lnBinExpr(ctx *context, scope *mod.Scope, n *mod.Node) ir.Operand {
+	a := lnExpr(ctx, scope, n.Leaves[0])
+	b := lnExpr(ctx, scope, n.Leaves[1])
+	return binOp(ctx, n, a, b)
+}
+
+func binOp(ctx *context, n *mod.Node, a, b ir.Operand) ir.Operand {
+	t := typeToIrType(n.T)
+	a = convert(ctx, a, t)
+	b = convert(ctx, b, t)
+	if isIntDivision(n, t) {
+		b = checkDivisor(ctx, n, b)
+	}
+	res := newTemp(ctx, t)
+	instr(ctx, opToInstr(n.Lexeme.Kind), t, []ir.Operand{a, b}, res)
+	return res
+}
+
+// embutidos que recebem o local da chamada, pra
+// mostrar onde aconteceu a divisão por zero
+var divisionBuiltins = map[string]bool{
+	"quociente": true,
+	"resto":     true,
+}
+
+func isIntDivision(n *mod.Node, t *irT.Type) bool {
+	switch n.Lexeme.Kind {
+	case lk.Division, lk.Remainder:
+		return t.Basic != irT.F64
+	}
+	return false
+}
+
+// o divisor passa antes pelo embutido 'divisor', que aborta
+// o programa se ele for zero, como o upt_divisor do C gerado
+func checkDivisor(ctx *context, n *mod.Node, b ir.Operand) ir.Operand {
+	proc := declareBuiltin(ctx, "divisor", &irT.Type{
+		Proc: &irT.ProcType{
+			Args: []*irT.Type{irT.T_I32, irT.T_Ptr},
+			Rets: []*irT.Type{irT.T_I32},
+		},
+	})
+	local := newCadeia(ctx, mod.Place(ctx.M, n).String())
+	checked := newTemp(ctx, irT.T_I32)
+	callBuiltin(ctx, proc, []ir.Operand{convert(ctx, b, irT.T_I32), local}, []ir.Operand{checked})
+	return convert(ctx, checked, b.Type)
+}
+
+// comparações são feitas no tipo comum entre os operandos,
+// o resultado é booleano
+func lnCompare(ctx *context, scope *mod.Scope, n *mod.Node) ir.Operand {
+	left := n.Leaves[0]
+	right := n.Leaves[1]
+	common := &T.Type{
+		Basic: T.ConversionTable[left.T.Basic][right.T.Basic],
+	}
+	t := typeToIrType(common)
+	a := lnExpr(ctx, scope, left)
+	a = convert(ctx, a, t)
+	b := lnExpr(ctx, scope, right)
+	b = convert(ctx, b, t)
+	if T.IsString(common) {
+		a, b = compareCadeias(ctx, a, b)
+		t = a.Type
+	}
+	res := newTemp(ctx, irT.T_Bool)
+	instr(ctx, opToInstr(n.Lexeme.Kind), t, []ir.Operand{a, b}, res)
+	return res
+}
+
+// cadeias são comparadas pelo conteudo, e não pelo endereço:
+// o embutido funciona como o strcmp do C, e o seu resultado
+// é comparado com zero
+func compareCadeias(ctx *context, a, b ir.Operand) (ir.Operand, ir.Operand) {
+	proc := declareBuiltin(ctx, "compara_cadeia", &irT.Type{
+		Proc: &irT.ProcType{
+			Args: []*irT.Type{irT.T_Ptr, irT.T_Ptr},
+			Rets: []*irT.Type{irT.T_I32},
+		},
+	})
+	res := newTemp(ctx, irT.T_I32)
+	callBuiltin(ctx, proc, []ir.Operand{a, b}, []ir.Operand{res})
+	zero := ir.Operand{Class: irc.Lit, Type: irT.T_I32, Num: 0}
+	return res, zero
+}
+
+// não existe instrução de potencia, então '^' vira
+// uma chamada ao embutido 'expo', que opera sobre reais
+func lnPotencia(ctx *context, scope *mod.Scope, n *mod.Node) ir.Operand {
+	expo := mod.Universe.Symbols["expo"]
+	proc := declareBuiltin(ctx, expo.Name, procToIrType(expo.Type))
+	a := convert(ctx, lnExpr(ctx, scope, n.Leaves[0]), irT.T_F64)
+	b := convert(ctx, lnExpr(ctx, scope, n.Leaves[1]), irT.T_F64)
+	res := newTemp(ctx, irT.T_F64)
+	callBuiltin(ctx, proc, []ir.Operand{a, b}, []ir.Operand{res})
+	return convert(ctx, res, typeToIrType(n.T))
+}
+
+func isComparison(kind lk.LexKind) bool {
+	switch kind {
+	case lk.Equals, lk.Different,
+		lk.Greater, lk.GreaterOrEquals, lk.Less, lk.LessOrEquals:
+		return true
+	}
+	return false
+}
+
+// 'e' e 'ou' precisam de curto-circuito, assim como em C,
+// senão chamadas no lado direito seriam executadas sempre
+func lnShortCircuit(ctx *context, scope *mod.Scope, n *mod.Node) ir.Operand {
+	t := typeToIrType(n.T)
+	res := newLocal(ctx, t)
+
+	a := lnCond(ctx, scope, n.Leaves[0])
+	copyTo(ctx, convert(ctx, a, t), res)
+
+	rightID := ctx.Proc.NewBlock()
+	exitID := ctx.Proc.NewBlock()
+	if n.Lexeme.Kind == lk.E {
+		ctx.CurrBlock.Branch(a, rightID, exitID)
+	} else {
+		ctx.CurrBlock.Branch(a, exitID, rightID)
+	}
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(rightID)
+	b := lnCond(ctx, scope, n.Leaves[1])
+	copyTo(ctx, convert(ctx, b, t), res)
+	ctx.CurrBlock.Jmp(exitID)
+
+	ctx.CurrBlock = ctx.Proc.GetBlock(exitID)
+	return res
+}
+
+func opToInstr(kind lk.LexKind) IK.InstrKind {
+	switch kind {
+	case lk.Ou:
+		return IK.Or
+	case lk.E:
+		return IK.And
+	case lk.Equals:
+		return IK.Eq
+	case lk.Different:
+		return IK.Diff
+	case lk.Greater:
+		return IK.More
+	case lk.GreaterOrEquals:
+		return IK.MoreEq
+	case lk.Less:
+		return IK.Less
+	case lk.LessOrEquals:
+		return IK.LessEq
+	case lk.Plus:
+		return IK.Add
+	case lk.Minus:
+		return IK.Sub
+	case lk.Star:
+		return IK.Mult
+	case lk.Division:
+		return IK.Div
+	case lk.Remainder:
+		return IK.Rem
+	}
+	panic("unreachable: operador sem instrução: " + kind.String())
+}
+
+func litToOperand(n *mod.Node) ir.Operand {
+	switch n.Lexeme.Kind {
+	case lk.CharLit:
+		return ir.Operand{
+			Class: irc.Lit,
+			Type:  irT.T_I8,
+			Num:   n.Lexeme.Value.(int64),
+		}
+	case lk.IntLit:
+		return ir.Operand{
+			Class: irc.Lit,
+			Type:  irT.T_I32,
+			Num:   n.Lexeme.Value.(int64),
+		}
+	case lk.RealLit:
+		// literais reais são guardados pelos seus bits
+		v := n.Lexeme.Value.(float64)
+		return ir.Operand{
+			Class: irc.Lit,
+			Type:  irT.T_F64,
+			Num:   int64(math.Float64bits(v)),
+		}
+	case lk.Verdadeiro:
+		return boolLit(true)
+	case lk.Falso:
+		return boolLit(false)
+	}
+	panic("unreachable")
+}
+
+// constantes não tem memória, o valor calculado
+// pelo typechecker é usado diretamente
+func constToOperand(ctx *context, sy *mod.Symbol) ir.Operand {
+	t := typeToIrType(sy.Type)
+	switch v := sy.Value.(type) {
+	case int64:
+		if t.Basic == irT.Bool {
+			// no modo de compatibilidade, logicos podem vir de inteiros
+			return boolLit(v != 0)
+		}
+		return ir.Operand{Class: irc.Lit, Type: t, Num: v}
+	case float64:
+		return ir.Operand{Class: irc.Lit, Type: irT.T_F64, Num: int64(math.Float64bits(v))}
+	case bool:
+		return boolLit(v)
+	case string:
+		return newCadeia(ctx, v)
+	}
+	panic("unreachable: constante inesperada: " + sy.String())
+}
+
+func boolLit(b bool) ir.Operand {
+	if b {
+		return ir.Operand{Class: irc.Lit, Type: irT.T_Bool, Num: 1}
+	}
+	return ir.Operand{Class: irc.Lit, Type: irT.T_Bool, Num: 0}
+}
+
+func zeroOf(t *T.Type) ir.Operand {
+	return ir.Operand{
+		Class: irc.Lit,
+		Type:  typeToIrType(t),
+		Num:   0,
+	}
+}
+
+func toBool(ctx *context, op ir.Operand) ir.Operand {
+	if op.Type.Basic == irT.Bool {
+		return op
+	}
+	zero := ir.Operand{Class: irc.Lit, Type: op.Type, Num: 0}
+	res := newTemp(ctx, irT.T_Bool)
+	instr(ctx, IK.Diff, op.Type, []ir.Operand{op, zero}, res)
+	return res
+}
+
+func convert(ctx *context, op ir.Operand, t *irT.Type) ir.Operand {
+	if op.Type.Basic == t.Basic {
+		return op
+	}
+	res := newTemp(ctx, t)
+	instr(ctx, IK.Convert, t, []ir.Operand{op}, res)
+	return res
+}
+
+// place é onde um valor pode ser guardado: locais e argumentos
+// escalares ficam num operando, o resto mora na memória e
+// o operando é o endereço
+type place struct {
+	Op       ir.Operand
+	InMemory bool
+	T        *T.Type
+}
+
+func findPlace(ctx *context, scope *mod.Scope, n *mod.Node) place {
+	switch n.Kind {
+	case nk.Terminal:
+		name := n.Lexeme.Text
+		sy := scope.Find(name)
+		switch sy.Kind {
+		case sk.Local, sk.Argument:
+			return findLocal(ctx, scope, name)
+		case sk.Global:
+			addr := ir.Operand{
+				Class: irc.Global,
+				Type:  irT.T_Ptr,
+				ID:    int64(ctx.GlobalMap[name]),
+			}
+			return place{Op: addr, InMemory: true, T: sy.Type}
+		}
+	case nk.Index:
+		return indexPlace(ctx, scope, n)
+	case nk.Field:
+		// field := {registro, id}
+		reg := n.Leaves[0]
+		base := findPlace(ctx, scope, reg)
+		off, t := fieldOffset(reg.T.Record, n.Leaves[1].Lexeme.Text)
+		addr := newTemp(ctx, irT.T_Ptr)
+		lit := ir.Operand{Class: irc.Lit, Type: irT.T_Ptr, Num: off}
+		instr(ctx, IK.Add, irT.T_Ptr, []ir.Operand{base.Op, lit}, addr)
+		return place{Op: addr, InMemory: true, T: t}
+	case nk.Call:
+		// o valor de um registro retornado já é um endereço
+		return place{Op: lnCall(ctx, scope, n), InMemory: true, T: n.T}
+	}
+	panic("unreachable: lugar inesperado: " + n.String())
+}
+
+// o elemento fica em 'vetor + indice * tamanho do elemento',
+// e o indice passa antes pelo embutido 'indice', que aborta
+// o programa se ele estiver fora dos limites, como no C gerado
+func indexPlace(ctx *context, scope *mod.Scope, n *mod.Node) place {
+	// index := {vetor, expr}
+	vetor := n.Leaves[0]
+	base := findPlace(ctx, scope, vetor)
+	idx := convert(ctx, lnExpr(ctx, scope, n.Leaves[1]), irT.T_I32)
+
+	proc := declareBuiltin(ctx, "indice", &irT.Type{
+		Proc: &irT.ProcType{
+			Args: []*irT.Type{irT.T_I32, irT.T_I32, irT.T_Ptr, irT.T_Ptr},
+			Rets: []*irT.Type{irT.T_I32},
+		},
+	})
+	length := ir.Operand{Class: irc.Lit, Type: irT.T_I32, Num: vetor.T.Array.Len}
+	local := newCadeia(ctx, mod.Place(ctx.M, n).String())
+	name := newCadeia(ctx, vetorName(vetor))
+	checked := newTemp(ctx, irT.T_I32)
+	callBuiltin(ctx, proc, []ir.Operand{idx, length, local, name}, []ir.Operand{checked})
+
+	elem := vetor.T.Array.Elem
+	return place{
+		Op:       offset(ctx, base.Op, convert(ctx, checked, irT.T_I64), sizeOf(elem)),
+		InMemory: true,
+		T:        elem,
+	}
+}
+
+func vetorName(n *mod.Node) string {
+	switch n.Kind {
+	case nk.Index:
+		return vetorName(n.Leaves[0])
+	case nk.Field:
+		return vetorName(n.Leaves[0]) + "." + n.Leaves[1].Lexeme.Text
+	case nk.Call:
+		return vetorName(n.Leaves[0]) + "(...)"
+	}
+	return n.Lexeme.Text
+}
+
+// offset calcula 'addr + i * size', com i do tipo i64
+func offset(ctx *context, addr, i ir.Operand, size int64) ir.Operand {
+	scale := ir.Operand{Class: irc.Lit, Type: irT.T_I64, Num: size}
+	bytes := newTemp(ctx, irT.T_I64)
+	instr(ctx, IK.Mult, irT.T_I64, []ir.Operand{i, scale}, bytes)
+	res := newTemp(ctx, irT.T_Ptr)
+	instr(ctx, IK.Add, irT.T_Ptr, []ir.Operand{addr, convert(ctx, bytes, irT.T_Ptr)}, res)
+	return res
+}
+
+// vetores e registros não cabem num operando,
+// então o valor deles é o proprio endereço
+func readPlace(ctx *context, p place) ir.Operand {
+	if !p.InMemory {
+		return p.Op
+	}
+	if !T.IsValue(p.T) {
+		return p.Op
+	}
+	t := typeToIrType(p.T)
+	res := newTemp(ctx, t)
+	instr(ctx, IK.LoadPtr, t, []ir.Operand{p.Op}, res)
+	return res
+}
+
+func writePlace(ctx *context, p place, op ir.Operand) {
+	if !p.InMemory {
+		copyTo(ctx, op, p.Op)
+		return
+	}
+	storeValue(ctx, op, p.Op, p.T)
+}
+
+// storeValue guarda o valor no endereço, o valor de um registro
+// é o endereço dele, então os bytes são copiados pelo embutido 'copia'
+func storeValue(ctx *context, op, addr ir.Operand, t *T.Type) {
+	if !T.IsRecord(t) {
+		store(ctx, op, addr)
+		return
+	}
+	copia := declareBuiltin(ctx, "copia", &irT.Type{
+		Proc: &irT.ProcType{
+			Args: []*irT.Type{irT.T_Ptr, irT.T_Ptr, irT.T_I64},
+			Rets: []*irT.Type{},
+		},
+	})
+	size := ir.Operand{Class: irc.Lit, Type: irT.T_I64, Num: sizeOf(t)}
+	callBuiltin(ctx, copia, []ir.Operand{addr, op, size}, []ir.Operand{})
+}
+
+func store(ctx *context, op, addr ir.Operand) {
+	ctx.CurrBlock.AddInstr(ir.Instr{
+		T:           IK.StorePtr,
+		Type:        op.Type,
+		Operands:    []ir.Operand{op, addr},
+		Destination: []ir.Operand{},
+	})
+}
+
+func copyTo(ctx *context, op, dest ir.Operand) {
+	instr(ctx, IK.Copy, dest.Type, []ir.Operand{op}, dest)
+}
+
+func instr(ctx *context, kind IK.InstrKind, t *irT.Type, ops []ir.Operand, dest ir.Operand) {
+	ctx.CurrBlock.AddInstr(ir.Instr{
+		T:           kind,
+		Type:        t,
+		Operands:    ops,
+		Destination: []ir.Operand{dest},
+	})
+}
+
+func newTemp(ctx *context, t *irT.Type) ir.Operand {
+	id := ctx.TempCounter
+	ctx.TempCounter++
+	return ir.Operand{
+		Class: irc.Temp,
+		Type:  t,
+		ID:    id,
+	}
+}
+
+// temporarios não sobrevivem entre blocos,
+// então valores que cruzam blocos precisam de uma local
+func newLocal(ctx *context, t *irT.Type) ir.Operand {
+	id := int64(len(ctx.Proc.Vars))
+	ctx.Proc.Vars = append(ctx.Proc.Vars, t)
+	return ir.Operand{
+		Class: irc.Local,
+		Type:  t,
+		ID:    id,
+	}
+}
+
+func findLocal(ctx *context, scope *mod.Scope, name string) place {
+	_, sc := scope.FindWithScope(name)
+	ss := scopedSymbol{
+		ScopeID: sc.ID,
+		Name:    name,
+	}
+	v, ok := ctx.LocalMap[ss]
+	if !ok {
+		panic(fmt.Sprintf("symbol not found: '%v' no escopo %v", name, sc.ID))
+	}
+	return v
+}
+
+// newMemory reserva memória pra uma local que não cabe num operando.
+// A memória é alocada uma vez no prologo, mas é zerada toda vez
+// que a declaração executa, como cadeias que começam vazias
+func newMemory(ctx *context, t *T.Type) ir.Operand {
+	slot := allocMemory(ctx, t)
+	size := sizeOf(t)
+	zera := declareBuiltin(ctx, "zera", &irT.Type{
+		Proc: &irT.ProcType{
+			Args: []*irT.Type{irT.T_Ptr, irT.T_I64},
+			Rets: []*irT.Type{},
+		},
+	})
+	sizeOp := ir.Operand{Class: irc.Lit, Type: irT.T_I64, Num: size}
+	callBuiltin(ctx, zera, []ir.Operand{slot, sizeOp}, []ir.Operand{})
+	return slot
+}
+
+func allocMemory(ctx *context, t *T.Type) ir.Operand {
+	slot := newLocal(ctx, irT.T_Ptr)
+	ctx.Memory = append(ctx.Memory, memory{Slot: slot, T: t})
+	return slot
+}
+
+// findAddressed marca as variaveis escalares passadas por referencia,
+// elas precisam morar na memória pra que exista um endereço
+func findAddressed(ctx *context, scope *mod.Scope, n *mod.Node) {
+	if n == nil {
+		return
+	}
+	switch n.Kind {
+	case nk.Block:
+		scope = n.Scope
+	case nk.Call:
+		// call := {proc, args}
+		proc := scope.Find(n.Leaves[0].Lexeme.Text)
+		for i, arg := range n.Leaves[1].Leaves {
+			if isRefArg(proc, i) && arg.Kind == nk.Terminal && arg.Lexeme.Kind == lk.Ident {
+				_, sc := scope.FindWithScope(arg.Lexeme.Text)
+				ss := scopedSymbol{ScopeID: sc.ID, Name: arg.Lexeme.Text}
+				ctx.Addressed[ss] = true
+			}
+		}
+	}
+	for _, leaf := range n.Leaves {
+		findAddressed(ctx, scope, leaf)
+	}
+}
+
+func isRefArg(proc *mod.Symbol, i int) bool {
+	return i < len(proc.Args) && proc.Args[i].Ref
+}
+
+// cada literal de cadeia vira uma declaração de memória,
+// e o valor da cadeia é o endereço dessa memória.
+// Cadeias nunca são modificadas, só substituidas,
+// então copiar o endereço é o mesmo que copiar a cadeia
+func newMessage(ctx *context, text string) ir.Operand {
+	// a gente mantem as aspas no token da string
+	return newCadeia(ctx, text[1:len(text)-1])
+}
+
+func newCadeia(ctx *context, data string) ir.Operand {
+	label := fmt.Sprintf("%v_msg%v", ctx.M.Name, len(ctx.P.Symbols))
+	id := ctx.P.AddMem(&ir.MemoryDecl{
+		Label: label,
+		// o zero no final, como em C
+		Size: int64(len(data)) + 1,
+		Data: data,
+	})
+	return ir.Operand{
+		Class: irc.Global,
+		Type:  irT.T_Ptr,
+		ID:    int64(id),
+	}
+}
+
+// builtin declara (uma unica vez) um procedimento embutido
+// que recebe no máximo um argumento e retorna no máximo um valor
+func builtin(ctx *context, name string, arg, ret *irT.Type) ir.Operand {
+	args := []*irT.Type{}
+	if arg != nil {
+		args = append(args, arg)
+	}
+	rets := []*irT.Type{}
+	if ret != nil {
+		rets = append(rets, ret)
+	}
+	t := &irT.Type{Proc: &irT.ProcType{Args: args, Rets: rets}}
+	return declareBuiltin(ctx, name, t)
+}
+
+// declareBuiltin declara o procedimento embutido na primeira vez que ele é usado
+func declareBuiltin(ctx *context, name string, t *irT.Type) ir.Operand {
+	id, ok := ctx.BuiltinMap[name]
+	if !ok {
+		id = ctx.P.AddProc(&ir.Procedure{
+			Label: name,
+			Args:  t.Proc.Args,
+			Rets:  t.Proc.Rets,
+		})
+		ctx.P.Symbols[id].Builtin = true
+		ctx.BuiltinMap[name] = id
+	}
+	return ir.Operand{
+		Class: irc.Global,
+		Type:  t,
+		ID:    int64(id),
+	}
+}
+
+func callBuiltin(ctx *context, proc ir.Operand, args []ir.Operand, dest []ir.Operand) {
+	ctx.CurrBlock.AddInstr(ir.Instr{
+		T:           IK.Call,
+		Type:        proc.Type,
+		Operands:    append([]ir.Operand{proc}, args...),
+		Destination: dest,
+	})
+}
+
+func globalLabel(M *mod.Module, sy *mod.Symbol) string {
+	return M.Name + "_" + sy.Name
+}
+
+// argumentos por referencia são o endereço da variavel
+func argToIrType(arg mod.Arg) *irT.Type {
+	if arg.Ref {
+		return irT.T_Ptr
+	}
+	return typeToIrType(arg.T)
+}
+
+func procToIrType(t *T.Type) *irT.Type {
+	args := []*irT.Type{}
+	for _, arg := range t.Proc.Args {
+		args = append(args, typeToIrType(arg))
+	}
+	rets := retsToIr(t.Proc.Ret)
+	return &irT.Type{Proc: &irT.ProcType{Args: args, Rets: rets}}
+}
+
+// procedimentos vazios não retornam nada
+func retsToIr(ret *T.Type) []*irT.Type {
+	if T.IsVoid(ret) {
+		return []*irT.Type{}
+	}
+	return []*irT.Type{typeToIrType(ret)}
+}
+
+func typeToIrType(t *T.Type) *irT.Type {
+	if T.IsProc(t) {
+		return procToIrType(t)
+	}
+	// vetores e registros são representados pelo endereço
+	if T.IsArray(t) || T.IsRecord(t) {
+		return irT.T_Ptr
+	}
+	switch t.Basic {
+	case T.Caractere:
+		return irT.T_I8
+	case T.Inteiro:
+		return irT.T_I32
+	case T.Real:
+		return irT.T_F64
+	case T.String:
+		return irT.T_Ptr
+	case T.Logico:
+		return irT.T_Bool
+	}
+	panic("unreachable")
+}
+
+// sizeOf é o tamanho em bytes de um valor do tipo na memória,
+// os campos dos registros ficam alinhados como em C
+func sizeOf(t *T.Type) int64 {
+	if T.IsArray(t) {
+		return t.Array.Len * sizeOf(t.Array.Elem)
+	}
+	if T.IsRecord(t) {
+		size := int64(0)
+		for _, f := range t.Record.Fields {
+			size = alignTo(size, alignOf(f.T)) + sizeOf(f.T)
+		}
+		return alignTo(size, alignOf(t))
+	}
+	switch t.Basic {
+	case T.Caractere, T.Logico:
+		return 1
+	case T.Inteiro:
+		return 4
+	case T.Real, T.String:
+		return 8
+	}
+	panic("unreachable: tipo sem tamanho: " + t.String())
+}
+
+func alignOf(t *T.Type) int64 {
+	if T.IsArray(t) {
+		return alignOf(t.Array.Elem)
+	}
+	if T.IsRecord(t) {
+		align := int64(1)
+		for _, f := range t.Record.Fields {
+			if a := alignOf(f.T); a > align {
+				align = a
+			}
+		}
+		return align
+	}
+	return sizeOf(t)
+}
+
+func alignTo(offset, align int64) int64 {
+	return (offset + align - 1) / align * align
+}
+
+// fieldOffset retorna a posição do campo dentro do registro,
+// seguindo o mesmo alinhamento de sizeOf
+func fieldOffset(rec *T.RecordType, name string) (int64, *T.Type) {
+	off := int64(0)
+	for _, f := range rec.Fields {
+		off = alignTo(off, alignOf(f.T))
+		if f.Name == name {
+			return off, f.T
+		}
+		off += sizeOf(f.T)
+	}
+	panic("unreachable: campo não encontrado: " + name)
 }
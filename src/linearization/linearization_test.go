@@ -0,0 +1,60 @@
+package linearization_test
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	FK "github.com/padeir0/pir/flowkind"
+
+	"upt/interpreter"
+	"upt/linearization"
+	"upt/pipelines"
+)
+
+// todo programa da suite que compila também precisa ser linearizado
+// e executado, então cada construção da linguagem é testada aqui
+// assim que ganha um arquivo na suite
+func TestSuite(t *testing.T) {
+	files, err := filepath.Glob("../../suite/*.uffp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		// arquivos com um codigo no nome esperam um erro
+		if strings.Count(name, ".") > 1 {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			m, errs := pipelines.Mod(file)
+			if errs != nil {
+				t.Fatalf("%v", errs)
+			}
+			p := linearization.Linearize(m)
+			for _, sy := range p.Symbols {
+				if sy.Proc == nil || sy.Builtin {
+					continue
+				}
+				for _, b := range sy.Proc.AllBlocks {
+					if b.Out.V == FK.InvalidFlow {
+						t.Errorf("%v: bloco %v sem saida", sy.Proc.Label, b.Label)
+					}
+				}
+			}
+			// o mesmo que o -ir mostra
+			_ = p.String()
+
+			code, err := interpreter.RunProgramWithTimeout(m, p, &bytes.Buffer{}, io.Discard, 1*time.Second)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if code != 0 {
+				t.Fatalf("exit status %v", code)
+			}
+		})
+	}
+}
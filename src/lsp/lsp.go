@@ -0,0 +1,570 @@
+package lsp
+
+import (
+	. "upt/core"
+	mod "upt/core/module"
+
+	ek "upt/core/errorkind"
+	lk "upt/core/lexeme/lexkind"
+	nk "upt/core/module/nodekind"
+	sk "upt/core/module/symbolkind"
+	sv "upt/core/severity"
+
+	"upt/pipelines"
+
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// servidor de Language Server Protocol sobre stdio,
+// as mensagens seguem o JSON-RPC 2.0 com o cabeçalho Content-Length
+
+type request struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type diagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type documentSymbol struct {
+	Name           string   `json:"name"`
+	Detail         string   `json:"detail"`
+	Kind           int      `json:"kind"`
+	Range          lspRange `json:"range"`
+	SelectionRange lspRange `json:"selectionRange"`
+}
+
+type textDocumentItem struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type didOpenParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type didCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type positionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+type documentSymbolParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+const (
+	symbolKindFunction = 12
+	symbolKindVariable = 13
+	symbolKindConstant = 14
+	symbolKindStruct   = 23
+
+	textDocumentSyncFull = 1
+
+	errMethodNotFound = -32601
+	errInvalidParams  = -32602
+)
+
+// document guarda o resultado da ultima analise de um arquivo,
+// Module pode ser nil se a resolução de nomes falhou
+type document struct {
+	URI    string
+	Path   string
+	Text   string
+	Root   *mod.Node
+	Module *mod.Module
+}
+
+type server struct {
+	In   *bufio.Reader
+	Out  io.Writer
+	Docs map[string]*document
+}
+
+// Serve atende requisições até receber 'exit' ou a entrada terminar
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{
+		In:   bufio.NewReader(in),
+		Out:  out,
+		Docs: map[string]*document{},
+	}
+	for {
+		body, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			return err
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		err = s.handle(&req)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (this *server) read() ([]byte, error) {
+	length := -1
+	for {
+		line, err := this.In.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "Content-Length:") {
+			text := strings.TrimSpace(strings.TrimPrefix(line, "Content-Length:"))
+			length, err = strconv.Atoi(text)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("mensagem sem Content-Length")
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(this.In, body)
+	return body, err
+}
+
+func (this *server) write(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	header := "Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n"
+	_, err = this.Out.Write(append([]byte(header), body...))
+	return err
+}
+
+func (this *server) reply(req *request, result interface{}) error {
+	if req.ID == nil {
+		return nil
+	}
+	return this.write(response{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+func (this *server) replyError(req *request, code int, message string) error {
+	if req.ID == nil {
+		return nil
+	}
+	return this.write(response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Error:   &responseError{Code: code, Message: message},
+	})
+}
+
+func (this *server) notify(method string, params interface{}) error {
+	return this.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (this *server) handle(req *request) error {
+	switch req.Method {
+	case "initialize":
+		return this.reply(req, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       textDocumentSyncFull,
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"documentSymbolProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "upt"},
+		})
+	case "initialized":
+		return nil
+	case "shutdown":
+		return this.reply(req, nil)
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if json.Unmarshal(req.Params, &p) != nil {
+			return nil
+		}
+		return this.update(p.TextDocument.URI, p.TextDocument.Text)
+	case "textDocument/didChange":
+		var p didChangeParams
+		if json.Unmarshal(req.Params, &p) != nil || len(p.ContentChanges) == 0 {
+			return nil
+		}
+		// sincronização completa: a ultima mudança tem o texto todo
+		text := p.ContentChanges[len(p.ContentChanges)-1].Text
+		return this.update(p.TextDocument.URI, text)
+	case "textDocument/didClose":
+		var p didCloseParams
+		if json.Unmarshal(req.Params, &p) != nil {
+			return nil
+		}
+		delete(this.Docs, p.TextDocument.URI)
+		return this.publish(p.TextDocument.URI, []diagnostic{})
+	case "textDocument/hover":
+		var p positionParams
+		if json.Unmarshal(req.Params, &p) != nil {
+			return this.replyError(req, errInvalidParams, "parametros invalidos")
+		}
+		return this.reply(req, this.hover(p))
+	case "textDocument/definition":
+		var p positionParams
+		if json.Unmarshal(req.Params, &p) != nil {
+			return this.replyError(req, errInvalidParams, "parametros invalidos")
+		}
+		return this.reply(req, this.definition(p))
+	case "textDocument/documentSymbol":
+		var p documentSymbolParams
+		if json.Unmarshal(req.Params, &p) != nil {
+			return this.replyError(req, errInvalidParams, "parametros invalidos")
+		}
+		return this.reply(req, this.symbols(p.TextDocument.URI))
+	}
+	return this.replyError(req, errMethodNotFound, "metodo não suportado: "+req.Method)
+}
+
+// update analisa o texto e publica os diagnosticos
+func (this *server) update(uri, text string) error {
+	doc := &document{
+		URI:  uri,
+		Path: uriToPath(uri),
+		Text: text,
+	}
+	this.Docs[uri] = doc
+	diags := []diagnostic{}
+	for _, err := range analyse(doc) {
+		diags = append(diags, toDiagnostic(err))
+	}
+	return this.publish(uri, diags)
+}
+
+func (this *server) publish(uri string, diags []diagnostic) error {
+	return this.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"diagnostics": diags,
+	})
+}
+
+// analyse roda as etapas de pipelines.Mod sobre o texto do editor,
+// e guarda o que for possivel pra hover e definição
+func analyse(doc *document) (errs []*Error) {
+	// o texto no editor está quase sempre incompleto,
+	// um panic aqui não pode derrubar o servidor
+	defer func() {
+		if r := recover(); r != nil {
+			doc.Module = nil
+			errs = []*Error{{
+				Code:     ek.InternalCompilerError,
+				Severity: sv.InternalError,
+				Message:  fmt.Sprintf("%v", r),
+			}}
+		}
+	}()
+	a := pipelines.Analyse(doc.Path, doc.Text)
+	doc.Root = a.Root
+	doc.Module = a.Module
+	all := append(ErrorList{}, a.Warnings...)
+	all = append(all, a.Errors...)
+	all.Sort()
+	return all
+}
+
+func (this *server) hover(p positionParams) interface{} {
+	doc, ok := this.Docs[p.TextDocument.URI]
+	if !ok || doc.Module == nil {
+		return nil
+	}
+	n, scope := findNode(doc.Module.Root, doc.Module.Global, p.Position)
+	if n == nil {
+		return nil
+	}
+	text := ""
+	if n.Lexeme != nil && n.Lexeme.Kind == lk.Ident {
+		sy := scope.Find(n.Lexeme.Text)
+		if sy == nil || sy.Type == nil {
+			return nil
+		}
+		text = describe(sy)
+	} else if n.T != nil {
+		text = n.T.String()
+	} else {
+		return nil
+	}
+	return map[string]interface{}{
+		"contents": map[string]string{
+			"kind":  "plaintext",
+			"value": text,
+		},
+		"range": toRange(n.Range),
+	}
+}
+
+func describe(sy *mod.Symbol) string {
+	switch sy.Kind {
+	case sk.Procedure:
+		return "procedimento " + sy.Name + ": " + sy.Type.String()
+	case sk.Argument:
+		if sy.Ref {
+			return "argumento por referencia " + sy.Name + ": " + sy.Type.String()
+		}
+		return "argumento " + sy.Name + ": " + sy.Type.String()
+	case sk.Local:
+		return "variavel " + sy.Name + ": " + sy.Type.String()
+	case sk.Global:
+		return "variavel global " + sy.Name + ": " + sy.Type.String()
+	case sk.Constant:
+		return "constante " + sy.Name + ": " + sy.Type.String()
+	case sk.Type:
+		return "registro " + sy.Name
+	case sk.Field:
+		return "campo " + sy.Name + ": " + sy.Type.String()
+	}
+	return sy.Name + ": " + sy.Type.String()
+}
+
+func (this *server) definition(p positionParams) interface{} {
+	doc, ok := this.Docs[p.TextDocument.URI]
+	if !ok || doc.Module == nil {
+		return nil
+	}
+	n, scope := findNode(doc.Module.Root, doc.Module.Global, p.Position)
+	if n == nil || n.Lexeme == nil || n.Lexeme.Kind != lk.Ident {
+		return nil
+	}
+	sy, _ := scope.FindWithScope(n.Lexeme.Text)
+	if sy == nil || sy.N == nil {
+		return nil
+	}
+	def := declNode(sy)
+	if def == nil || def.Range == nil {
+		return nil
+	}
+	return location{URI: doc.URI, Range: toRange(def.Range)}
+}
+
+// declNode retorna o identificador na declaração do simbolo
+func declNode(sy *mod.Symbol) *mod.Node {
+	switch sy.Kind {
+	case sk.Procedure:
+		// proc := {id, args, retNode, bl}
+		return sy.N.Leaves[0]
+	case sk.Argument:
+		// arg := {tipo, id, ref}
+		return sy.N.Leaves[1]
+	case sk.Constant:
+		// const := {type, id, expr}
+		return sy.N.Leaves[1]
+	case sk.Type:
+		// record := {id, vardecl...}
+		return sy.N.Leaves[0]
+	}
+	return sy.N
+}
+
+func (this *server) symbols(uri string) interface{} {
+	doc, ok := this.Docs[uri]
+	out := []documentSymbol{}
+	if !ok || doc.Root == nil {
+		return out
+	}
+	for _, n := range doc.Root.Leaves {
+		ids, kind := globalIds(n)
+		for _, id := range ids {
+			detail := ""
+			if doc.Module != nil {
+				sy := doc.Module.Global.Symbols[id.Lexeme.Text]
+				if sy != nil && declNode(sy) == id && sy.Type != nil {
+					detail = sy.Type.String()
+				}
+			}
+			rng := n.Range
+			if kind == symbolKindVariable {
+				rng = id.Range
+			}
+			out = append(out, documentSymbol{
+				Name:           id.Lexeme.Text,
+				Detail:         detail,
+				Kind:           kind,
+				Range:          toRange(rng),
+				SelectionRange: toRange(id.Range),
+			})
+		}
+	}
+	return out
+}
+
+// globalIds retorna os identificadores declarados
+// por um nó no topo do arquivo
+func globalIds(n *mod.Node) ([]*mod.Node, int) {
+	switch n.Kind {
+	case nk.Procedure:
+		// proc := {id, args, retNode, bl}
+		return n.Leaves[:1], symbolKindFunction
+	case nk.Constant:
+		// const := {type, id, expr}
+		return n.Leaves[1:2], symbolKindConstant
+	case nk.VarDecl:
+		// vardecl := {type, id...}
+		return n.Leaves[1:], symbolKindVariable
+	case nk.Record:
+		// record := {id, vardecl...}
+		return n.Leaves[:1], symbolKindStruct
+	}
+	return nil, 0
+}
+
+// findNode retorna o nó mais profundo que contém a posição,
+// junto do escopo em que ele se encontra
+func findNode(n *mod.Node, scope *mod.Scope, p position) (*mod.Node, *mod.Scope) {
+	if n == nil {
+		return nil, nil
+	}
+	if n.Scope != nil {
+		scope = n.Scope
+	}
+	for _, leaf := range n.Leaves {
+		if leaf == nil || leaf.Range == nil || !contains(leaf.Range, p) {
+			continue
+		}
+		found, sc := findNode(leaf, scope, p)
+		if found != nil {
+			return found, sc
+		}
+	}
+	if n.Lexeme != nil && n.Range != nil && contains(n.Range, p) {
+		return n, scope
+	}
+	return nil, nil
+}
+
+func contains(r *Range, p position) bool {
+	pos := Position{Line: p.Line, Column: p.Character}
+	return pos.MoreOrEqualsThan(r.Begin) && !pos.MoreThan(r.End)
+}
+
+func toRange(r *Range) lspRange {
+	if r == nil {
+		return lspRange{}
+	}
+	return lspRange{
+		Start: position{Line: r.Begin.Line, Character: r.Begin.Column},
+		End:   position{Line: r.End.Line, Character: r.End.Column},
+	}
+}
+
+func toDiagnostic(err *Error) diagnostic {
+	var rng lspRange
+	if err.Location != nil {
+		rng = toRange(err.Location.Range)
+	}
+	message := stripColors(err.Message)
+	if err.Hint != "" {
+		message += " (dica: " + err.Hint + ")"
+	}
+	return diagnostic{
+		Range:    rng,
+		Severity: toSeverity(err.Severity),
+		Code:     err.ErrCode(),
+		Source:   "upt",
+		Message:  message,
+	}
+}
+
+func toSeverity(s sv.Severity) int {
+	switch s {
+	case sv.Warning:
+		return 2
+	case sv.Information:
+		return 3
+	case sv.Hint:
+		return 4
+	}
+	return 1
+}
+
+var colorCodes = regexp.MustCompile("\u001b\\[[0-9;]*m")
+
+// as mensagens de erro usam cores ANSI que não fazem sentido no editor
+func stripColors(s string) string {
+	return colorCodes.ReplaceAllString(s, "")
+}
+
+// uriToPath retorna o caminho do arquivo, de onde a resolução tira
+// o nome do modulo. Documentos que não estão no disco, como
+// 'untitled:Untitled-1', não tem um nome valido, e usam unsavedPath
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" || u.Path == "" {
+		return unsavedPath
+	}
+	return u.Path
+}
+
+const unsavedPath = "sem_titulo.uffp"
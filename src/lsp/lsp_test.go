@@ -0,0 +1,261 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	ek "upt/core/errorkind"
+	"upt/pipelines"
+)
+
+// client conversa com o servidor pelos dois lados de um pipe,
+// como um editor faria pelo stdio
+type client struct {
+	T   *testing.T
+	In  io.Writer
+	Out *bufio.Reader
+}
+
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+type publishParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+func newClient(t *testing.T) (*client, chan error) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(inR, outW)
+		outW.Close()
+	}()
+	return &client{T: t, In: inW, Out: bufio.NewReader(outR)}, done
+}
+
+// send manda uma requisição, ou uma notificação se id for nil
+func (this *client) send(id *int, method string, params interface{}) {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method}
+	if id != nil {
+		msg["id"] = *id
+	}
+	if params != nil {
+		msg["params"] = params
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		this.T.Fatal(err)
+	}
+	header := "Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n"
+	_, err = this.In.Write(append([]byte(header), body...))
+	if err != nil {
+		this.T.Fatal(err)
+	}
+}
+
+func (this *client) receive() *message {
+	length := -1
+	for {
+		line, err := this.Out.ReadString('\n')
+		if err != nil {
+			this.T.Fatal(err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "Content-Length:") {
+			length, _ = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Content-Length:")))
+		}
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(this.Out, body)
+	if err != nil {
+		this.T.Fatal(err)
+	}
+	var msg message
+	err = json.Unmarshal(body, &msg)
+	if err != nil {
+		this.T.Fatal(err)
+	}
+	return &msg
+}
+
+func (this *client) open(uri, text string) *publishParams {
+	this.send(nil, "textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri, "text": text},
+	})
+	msg := this.receive()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		this.T.Fatalf("esperado publishDiagnostics, recebido %q", msg.Method)
+	}
+	var p publishParams
+	err := json.Unmarshal(msg.Params, &p)
+	if err != nil {
+		this.T.Fatal(err)
+	}
+	if p.URI != uri {
+		this.T.Fatalf("diagnosticos de %q, esperado %q", p.URI, uri)
+	}
+	return &p
+}
+
+func codes(diags []diagnostic) string {
+	out := []string{}
+	for _, d := range diags {
+		out = append(out, d.Code)
+	}
+	return fmt.Sprint(out)
+}
+
+func id(i int) *int {
+	return &i
+}
+
+const semErros = `inteiro entrada() {
+	retorne 0;
+}
+`
+
+const naoDeclarada = `inteiro entrada() {
+	retorne x;
+}
+`
+
+const semRetorno = `inteiro f(inteiro x) {
+	se (x > 0) {
+		retorne 1;
+	}
+}
+
+inteiro entrada() {
+	retorne f(1);
+}
+`
+
+func TestSession(t *testing.T) {
+	c, done := newClient(t)
+
+	c.send(id(1), "initialize", map[string]interface{}{})
+	msg := c.receive()
+	if msg.ID == nil || *msg.ID != 1 || msg.Error != nil {
+		t.Fatalf("resposta invalida ao initialize: %+v", msg)
+	}
+	var init struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	err := json.Unmarshal(msg.Result, &init)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if init.Capabilities["hoverProvider"] != true {
+		t.Fatalf("capacidades incompletas: %v", init.Capabilities)
+	}
+	c.send(nil, "initialized", map[string]interface{}{})
+
+	p := c.open("file:///tmp/programa.uffp", semErros)
+	if len(p.Diagnostics) != 0 {
+		t.Fatalf("esperado nenhum diagnostico, recebido %v", codes(p.Diagnostics))
+	}
+
+	// documentos que não foram salvos não tem um nome de arquivo,
+	// e isso não deveria virar um E014
+	p = c.open("untitled:Untitled-1", naoDeclarada)
+	if len(p.Diagnostics) != 1 || p.Diagnostics[0].Code != "E009" {
+		t.Fatalf("esperado [E009], recebido %v", codes(p.Diagnostics))
+	}
+	d := p.Diagnostics[0]
+	if d.Range.Start.Line != 1 || d.Severity != 1 {
+		t.Fatalf("diagnostico no lugar errado: %+v", d)
+	}
+
+	// os erros de termination também são publicados
+	p = c.open("file:///tmp/retorno.uffp", semRetorno)
+	if len(p.Diagnostics) != 1 || p.Diagnostics[0].Code != "E019" {
+		t.Fatalf("esperado [E019], recebido %v", codes(p.Diagnostics))
+	}
+
+	c.send(id(2), "shutdown", nil)
+	msg = c.receive()
+	if msg.ID == nil || *msg.ID != 2 || msg.Error != nil {
+		t.Fatalf("resposta invalida ao shutdown: %+v", msg)
+	}
+	c.send(nil, "exit", nil)
+	err = <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// avisos e erros de varios procedimentos, que saem
+// do typechecker e das outras etapas em ordem de mapa
+const variosAvisos = `inteiro a(inteiro p) {
+	inteiro x;
+	retorne x;
+}
+
+inteiro b(inteiro q) {
+	inteiro y;
+	retorne y;
+}
+
+inteiro c(inteiro r) {
+	inteiro z;
+	retorne z;
+}
+
+inteiro entrada() {
+	retorne a(1) + b(2) + c(3);
+}
+`
+
+func TestDiagnosticsOrder(t *testing.T) {
+	c, done := newClient(t)
+	for i := 0; i < 10; i++ {
+		p := c.open("file:///tmp/avisos.uffp", variosAvisos)
+		expected := "[W003 E030 W003 E030 W003 E030]"
+		if codes(p.Diagnostics) != expected {
+			t.Fatalf("esperado %v, recebido %v", expected, codes(p.Diagnostics))
+		}
+		for j, d := range p.Diagnostics {
+			if d.Range.Start.Line != 5*(j/2)+2*(j%2) {
+				t.Fatalf("diagnosticos fora de ordem: %+v", p.Diagnostics)
+			}
+		}
+	}
+
+	// os avisos silenciados na linha de comando também somem do editor
+	pipelines.SilencedWarnings[ek.UnusedArgument] = true
+	defer delete(pipelines.SilencedWarnings, ek.UnusedArgument)
+	p := c.open("file:///tmp/avisos.uffp", variosAvisos)
+	if codes(p.Diagnostics) != "[E030 E030 E030]" {
+		t.Fatalf("esperado [E030 E030 E030], recebido %v", codes(p.Diagnostics))
+	}
+	c.send(nil, "exit", nil)
+	<-done
+}
+
+func TestUriToPath(t *testing.T) {
+	cases := map[string]string{
+		"file:///home/ana/prog.uffp":       "/home/ana/prog.uffp",
+		"file:///home/ana/meu%20prog.uffp": "/home/ana/meu prog.uffp",
+		"untitled:Untitled-1":              unsavedPath,
+	}
+	for uri, path := range cases {
+		if got := uriToPath(uri); got != path {
+			t.Errorf("uriToPath(%q) = %q, esperado %q", uri, got, path)
+		}
+	}
+}
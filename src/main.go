@@ -2,8 +2,13 @@ package main
 
 import (
 	. "upt/core"
+	colors "upt/core/asciicolors"
+	ek "upt/core/errorkind"
+	"upt/lsp"
 	"upt/pipelines"
+	"upt/report"
 	"upt/testing"
+	"upt/typechecker"
 
 	"flag"
 	"fmt"
@@ -16,17 +21,36 @@ var lexemes = flag.Bool("lex", false, "processa um arquivo e retorna os elemento
 var ast = flag.Bool("ast", false, "processa um arquivo e retorma uma arvore sintatica abstrata")
 var mod = flag.Bool("mod", false, "processa um arquivo e retorma um módulo tipado")
 var C = flag.Bool("C", false, "processa um arquivo e emite C")
+var IR = flag.Bool("ir", false, "processa um arquivo e emite a representação intermediaria")
+var run = flag.Bool("run", false, "executa um arquivo no interpretador, sem compilar")
+var debug = flag.Bool("debug", false, "executa um arquivo no depurador")
 
-var test = flag.Bool("test", false, "roda testes para todos os arquivos em uma pasta")
+var test = flag.Bool("test", false, "roda testes para todos os arquivos em uma pasta (com -run, usa o interpretador)")
 
 var verbose = flag.Bool("v", false, "testes verbosos")
 
+var maxErros = flag.Int("maxerros", 10, "numero maximo de erros mostrados, 0 mostra todos (só no formato text)")
+var format = flag.String("format", "text", "formato dos erros e avisos: text, json ou sarif")
+
+var silence = flag.String("silencie", "", "lista de codigos de aviso que não são mostrados, separados por virgula (ex: W002,W005)")
+var warningsAsErrors = flag.Bool("avisoserro", false, "trata avisos como erros")
+
+var compat = flag.Bool("compat", false, "aceita inteiros em condições e nos operadores 'e', 'ou' e 'nao'")
+
 func main() {
 	flag.Parse()
+	typechecker.CompatibilityMode = *compat
+	pipelines.WarningsAsErrors = *warningsAsErrors
+	pipelines.SilencedWarnings = parseSilenced(*silence)
+	checkFormat()
 	args := flag.Args()
 	if len(args) != 1 {
 		Fatal("número de argumentos invalido\n")
 	}
+	if args[0] == "lsp" {
+		serveLSP()
+		return
+	}
 	eval(args[0])
 }
 
@@ -62,14 +86,105 @@ func normalMode(filename string) {
 		str, err := pipelines.GenC(filename)
 		Check(err)
 		fmt.Println(str)
+	case *IR:
+		p, err := pipelines.IR(filename)
+		Check(err)
+		fmt.Println(p.String())
+	case *run:
+		code, err := pipelines.Run(filename, os.Stdin, os.Stdout)
+		// um erro em tempo de execução sai com o mesmo codigo do C gerado
+		checkWithCode(err, code)
+		finish()
+		os.Exit(code)
+	case *debug:
+		code, err := pipelines.Debug(filename, os.Stdin, os.Stdout)
+		checkWithCode(err, code)
+		finish()
+		os.Exit(code)
 	default:
 		_, err := pipelines.Compile(filename)
 		Check(err)
 	}
+	finish()
+}
+
+// checkFormat valida -format. As cores são desligadas nos formatos
+// para maquinas e quando stderr não é um terminal
+func checkFormat() {
+	switch *format {
+	case "text":
+	case "json", "sarif":
+		pipelines.PrintWarnings = false
+	default:
+		Fatal("formato desconhecido: " + *format + ", use text, json ou sarif\n")
+	}
+	if *format != "text" || !isTerminal(os.Stderr) {
+		colors.Disable()
+	}
+}
+
+// isTerminal diz se o arquivo é um terminal, e não um pipe ou arquivo
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// finish mostra os avisos de uma compilação sem erros nos formatos
+// para maquinas, no formato text eles já foram mostrados pelo pipeline
+func finish() {
+	if *format != "text" {
+		emit(pipelines.Warnings)
+	}
+}
+
+// emit escreve os diagnosticos em stderr no formato escolhido
+func emit(errs ErrorList) {
+	var out []byte
+	var err error
+	switch *format {
+	case "json":
+		out, err = report.JSON(errs)
+	case "sarif":
+		out, err = report.SARIF(errs)
+	}
+	if err != nil {
+		Fatal(err.Error() + "\n")
+	}
+	os.Stderr.Write(append(out, '\n'))
+}
+
+func parseSilenced(list string) map[ek.ErrorKind]bool {
+	codes := map[string]ek.ErrorKind{}
+	for kind, code := range ek.ErrorCodeMap {
+		if strings.HasPrefix(code, "W") {
+			codes[code] = kind
+		}
+	}
+	out := map[ek.ErrorKind]bool{}
+	for _, code := range strings.Split(list, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" {
+			continue
+		}
+		kind, ok := codes[code]
+		if !ok {
+			Fatal("codigo de aviso desconhecido: " + code + "\n")
+		}
+		out[kind] = true
+	}
+	return out
+}
+
+// upt lsp: servidor de Language Server Protocol sobre stdio
+func serveLSP() {
+	err := lsp.Serve(os.Stdin, os.Stdout)
+	if err != nil {
+		Fatal(err.Error() + "\n")
+	}
 }
 
 func checkValid() {
-	var selected = []bool{*lexemes, *ast, *mod, *C}
+	var selected = []bool{*lexemes, *ast, *mod, *C, *IR, *run, *debug}
 	var count = 0
 	for _, b := range selected {
 		if b {
@@ -77,7 +192,7 @@ func checkValid() {
 		}
 	}
 	if count > 1 {
-		Fatal("escolha apenas uma das seguintes flags: lex, ast, mod ou C")
+		Fatal("escolha apenas uma das seguintes flags: lex, ast, mod, C, ir, run ou debug")
 	}
 }
 
@@ -99,7 +214,12 @@ func Test(folder string) []*testing.TestResult {
 				fmt.Print("\u001b[35m leaving: " + fullpath + "\u001b[0m\n")
 			}
 		} else {
-			res := testing.Test(fullpath)
+			var res testing.TestResult
+			if *run {
+				res = testing.Interpret(fullpath)
+			} else {
+				res = testing.Test(fullpath)
+			}
 			results = append(results, &res)
 			if *verbose {
 				fmt.Print(fullpath + "\t")
@@ -126,10 +246,43 @@ func printResults(results []*testing.TestResult) {
 	fmt.Print("total: " + strconv.Itoa(len(results)) + "\n")
 }
 
-func Check(e *Error) {
-	if e != nil {
-		Fatal(e.String() + "\n")
+// Check mostra os erros na ordem em que aparecem no arquivo,
+// até o limite de -maxerros, e termina o programa.
+// Nos formatos json e sarif todos os erros são mostrados
+func Check(errs ErrorList) {
+	checkWithCode(errs, 0)
+}
+
+// checkWithCode mostra os erros e termina com o codigo dado
+func checkWithCode(errs ErrorList, code int) {
+	if errs == nil {
+		return
+	}
+	if *format != "text" {
+		// nos formatos para maquinas os avisos vão junto dos erros
+		all := append(ErrorList{}, pipelines.Warnings...)
+		all = append(all, errs...)
+		all.Sort()
+		emit(all)
+		os.Exit(code)
+	}
+	errs.Sort()
+	shown := errs
+	if *maxErros > 0 && len(errs) > *maxErros {
+		shown = errs[:*maxErros]
+	}
+	output := ""
+	for _, err := range shown {
+		output += err.String() + "\n"
+	}
+	switch hidden := len(errs) - len(shown); {
+	case hidden == 1:
+		output += "... e mais 1 erro\n"
+	case hidden > 1:
+		output += fmt.Sprintf("... e mais %v erros\n", hidden)
 	}
+	os.Stderr.Write([]byte(output))
+	os.Exit(code)
 }
 
 func Fatal(s string) {
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"upt/report"
+)
+
+// com UPT_MAIN o binario de teste se comporta como o upt,
+// assim os testes conseguem rodar a linha de comando de verdade
+func TestMain(m *testing.M) {
+	if os.Getenv("UPT_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func runUpt(t *testing.T, args ...string) []byte {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "UPT_MAIN=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	return out
+}
+
+// os avisos acham problemas antes das etapas que podem falhar,
+// e devem aparecer junto dos erros nos formatos para maquinas
+func TestJSONWarningsWithErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "avisoerro.uffp")
+	src := "inteiro entrada() {\n\tinteiro x, naousada;\n\tretorne x;\n}\n"
+	err := os.WriteFile(file, []byte(src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := runUpt(t, "-format=json", file)
+	var diags []report.Diagnostic
+	err = json.Unmarshal(out, &diags)
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	codes := []string{}
+	for _, d := range diags {
+		codes = append(codes, d.Code+" "+d.Severity)
+	}
+	if len(codes) != 2 || codes[0] != "W002 warning" || codes[1] != "E030 error" {
+		t.Fatalf("esperado [W002 warning E030 error], recebido %v", codes)
+	}
+}
+
+// um erro em tempo de execução no interpretador sai com 1,
+// como o programa compilado
+func TestRunRuntimeError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "divisao.uffp")
+	src := "inteiro entrada() {\n\tinteiro x;\n\tx = 0;\n\tretorne 1 / x;\n}\n"
+	err := os.WriteFile(file, []byte(src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-run", file)
+	cmd.Env = append(os.Environ(), "UPT_MAIN=1")
+	out, err := cmd.CombinedOutput()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("esperado codigo de saida 1, recebido %v: %s", err, out)
+	}
+	if !strings.Contains(string(out), "error: divisão por zero") {
+		t.Fatalf("mensagem inesperada: %s", out)
+	}
+}
@@ -11,61 +11,224 @@ import (
 	mod "upt/core/module"
 
 	lxr "upt/lexer"
+	"upt/suggestion"
 
 	"fmt"
 	"strings"
 )
 
-func Parse(filename string, contents string) (*mod.Node, *Error) {
+// Parse retorna todos os erros de sintaxe do arquivo,
+// não só o primeiro, ver recoverFrom
+func Parse(filename string, contents string) (*mod.Node, ErrorList) {
 	l := lxr.NewLexer(filename, contents)
 	err := l.Next()
 	if err != nil {
-		return nil, err
+		return nil, ErrorList{err}
 	}
 	n, err := portugol(l)
 	if err != nil {
-		return nil, err
+		addError(l, err)
 	}
-	if l.Word.Kind != lk.EOF {
-		return nil, newError(l, ek.ExpectedEOF, "esperado final do arquivo")
+	if len(l.Errors) > 0 {
+		return nil, l.Errors
 	}
 	computeRanges(n)
 	return n, nil
 }
 
-// Portugol := {Funcao}.
+// Portugol := {Global}.
 func portugol(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "portugol")
-	funcs, err := repeat(l, funcao)
-	if err != nil {
-		return nil, err
+	var globals []*mod.Node
+	for l.Word.Kind != lk.EOF {
+		first := l.Word
+		n, err := global(l)
+		if err == nil && n == nil {
+			err = newError(l, ek.ExpectedEOF, "esperado final do arquivo")
+			addError(l, err)
+			// o simbolo pode ser um '}' sem par, que recoverFrom não pula
+			_, err = consume(l)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			keywordHint(l, err, first)
+			err = recoverFrom(l, err)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		globals = append(globals, n)
 	}
 	return &mod.Node{
-		Leaves: funcs,
+		Leaves: globals,
 		Kind:   nk.Module,
 	}, nil
 }
 
-// Funcao := [tipo] ident '(' [ArgList] ')' Bloco.
-func funcao(l *lxr.Lexer) (*mod.Node, *Error) {
-	lxr.Track(l, "funcao")
-	if !(isType(l.Word) || l.Word.Kind == lk.Ident) {
-		return nil, nil
+/*
+Global := Funcao
+        | GlobalVar term
+        | Constante term
+        | Registro.
+
+tanto funções quanto variaveis globais começam com 'tipo ident',
+então só sabemos qual das duas estamos lendo depois do identificador
+*/
+func global(l *lxr.Lexer) (*mod.Node, *Error) {
+	lxr.Track(l, "global")
+	switch l.Word.Kind {
+	case lk.Constante:
+		return prodSemicolon(l, constante)
+	case lk.Registro:
+		return registro(l)
+	case lk.Vazio:
+		// não existem variaveis vazias, então só pode ser uma função
+		tipo, err := consume(l)
+		if err != nil {
+			return nil, err
+		}
+		id, err := expect(l, lk.Ident)
+		if err != nil {
+			return nil, err
+		}
+		return funcao(l, tipo, id)
 	}
-	var retNode *mod.Node
+	var tipo *mod.Node
 	var err *Error
+	if l.Word.Kind == lk.Ident {
+		tipo, err = consume(l)
+		if err != nil {
+			return nil, err
+		}
+		// 'ident ident' é uma declaração cujo tipo é um registro,
+		// 'ident (' é uma função sem tipo de retorno
+		if l.Word.Kind != lk.Ident {
+			return funcao(l, nil, tipo)
+		}
+	} else {
+		if !isType(l.Word) {
+			return nil, nil
+		}
+		tipo, err = consume(l)
+		if err != nil {
+			return nil, err
+		}
+	}
+	id, err := expect(l, lk.Ident)
+	if err != nil {
+		return nil, err
+	}
+	if l.Word.Kind == lk.LeftParen {
+		return funcao(l, tipo, id)
+	}
+	n, err := globalVar(l, tipo, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = expect(l, lk.Semicolon)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
 
-	if isType(l.Word) {
-		retNode, err = consume(l)
+// GlobalVar := tipo DeclList.
+func globalVar(l *lxr.Lexer, tipo, id *mod.Node) (*mod.Node, *Error) {
+	lxr.Track(l, "globalVar")
+	err := declSizes(l, id)
+	if err != nil {
+		return nil, err
+	}
+	ids := []*mod.Node{id}
+	for l.Word.Kind == lk.Comma {
+		_, err = consume(l)
+		if err != nil {
+			return nil, err
+		}
+		id, err = expectProd(l, declId, "identificador")
 		if err != nil {
 			return nil, err
 		}
+		ids = append(ids, id)
+	}
+	return &mod.Node{
+		Leaves: append([]*mod.Node{tipo}, ids...),
+		Kind:   nk.VarDecl,
+	}, nil
+}
+
+// Constante := 'constante' tipo ident '=' Expr.
+func constante(l *lxr.Lexer) (*mod.Node, *Error) {
+	lxr.Track(l, "constante")
+	_, err := expect(l, lk.Constante)
+	if err != nil {
+		return nil, err
+	}
+	tipo, err := expectType(l)
+	if err != nil {
+		return nil, err
 	}
 	id, err := expect(l, lk.Ident)
 	if err != nil {
 		return nil, err
 	}
-	_, err = expect(l, lk.LeftParen)
+	_, err = expect(l, lk.Assign)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := expectProd(l, expr, "expressão")
+	if err != nil {
+		return nil, err
+	}
+	return &mod.Node{
+		Leaves: []*mod.Node{tipo, id, exp},
+		Kind:   nk.Constant,
+	}, nil
+}
+
+// Registro := 'registro' ident '{' {VarDecl term} '}'.
+// os campos ficam como declarações de variaveis após o nome
+func registro(l *lxr.Lexer) (*mod.Node, *Error) {
+	lxr.Track(l, "registro")
+	_, err := expect(l, lk.Registro)
+	if err != nil {
+		return nil, err
+	}
+	id, err := expect(l, lk.Ident)
+	if err != nil {
+		return nil, err
+	}
+	_, err = expect(l, lk.LeftBrace)
+	if err != nil {
+		return nil, err
+	}
+	leaves := []*mod.Node{id}
+	for l.Word.Kind != lk.RightBrace {
+		campo, err := prodSemicolon(l, varDecl)
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, campo)
+	}
+	_, err = expect(l, lk.RightBrace)
+	if err != nil {
+		return nil, err
+	}
+	return &mod.Node{
+		Leaves: leaves,
+		Kind:   nk.Record,
+	}, nil
+}
+
+// Funcao := [tipo | 'vazio'] ident '(' [ArgList] ')' Bloco.
+// o tipo e o identificador já foram lidos por Global
+func funcao(l *lxr.Lexer, retNode, id *mod.Node) (*mod.Node, *Error) {
+	lxr.Track(l, "funcao")
+	_, err := expect(l, lk.LeftParen)
 	if err != nil {
 		return nil, err
 	}
@@ -106,19 +269,27 @@ func argList(l *lxr.Lexer) (*mod.Node, *Error) {
 	}, nil
 }
 
-// Arg := tipo ident.
+// Arg := tipo ['&'] ident.
+// o '&' fica como terceira folha, ou nil se o argumento é por valor
 func arg(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "arg")
-	tipo, err := expect(l, lk.Real, lk.Inteiro, lk.Caractere)
+	tipo, err := expectType(l)
 	if err != nil {
 		return nil, err
 	}
+	var ref *mod.Node
+	if l.Word.Kind == lk.Ampersand {
+		ref, err = consume(l)
+		if err != nil {
+			return nil, err
+		}
+	}
 	id, err := expect(l, lk.Ident)
 	if err != nil {
 		return nil, err
 	}
 	return &mod.Node{
-		Leaves: []*mod.Node{tipo, id},
+		Leaves: []*mod.Node{tipo, id, ref},
 		Kind:   nk.ArgumentList,
 	}, nil
 }
@@ -130,7 +301,7 @@ func bloco(l *lxr.Lexer) (*mod.Node, *Error) {
 	if err != nil {
 		return nil, err
 	}
-	comandos, err := repeat(l, comando)
+	cmds, err := comandos(l, lk.RightBrace)
 	if err != nil {
 		return nil, err
 	}
@@ -139,11 +310,46 @@ func bloco(l *lxr.Lexer) (*mod.Node, *Error) {
 		return nil, err
 	}
 	return &mod.Node{
-		Leaves: comandos,
+		Leaves: cmds,
 		Kind:   nk.Block,
 	}, nil
 }
 
+// Comandos := {Comando}.
+// um comando com erro é guardado em l.Errors e o resto dele é pulado
+// (ver recoverFrom), assim os comandos seguintes ainda são lidos.
+// 'fim' são os simbolos que terminam a lista, e sempre contém '}'
+func comandos(l *lxr.Lexer, fim ...lk.LexKind) ([]*mod.Node, *Error) {
+	var out []*mod.Node
+	for !isKind(l.Word, fim) && l.Word.Kind != lk.EOF {
+		first := l.Word
+		n, err := comando(l)
+		if err == nil && n == nil {
+			// nenhum comando começa com esse simbolo
+			err = check(l, fim...)
+		}
+		if err != nil {
+			keywordHint(l, err, first)
+			err = recoverFrom(l, err)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func isKind(l *lex.Lexeme, kinds []lk.LexKind) bool {
+	for _, kind := range kinds {
+		if l.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
 /*
 Comando := Atrib term
          | VarDecl term
@@ -151,8 +357,12 @@ Comando := Atrib term
          | Leia term
          | Imprima term
          | Se
+         | Escolha
          | Enquanto
-         | Para.
+         | Faca term
+         | Para
+         | Pare term
+         | Continue term.
 */
 func comando(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "comando")
@@ -163,13 +373,19 @@ func comando(l *lxr.Lexer) (*mod.Node, *Error) {
 		return prodSemicolon(l, imprima)
 	case lk.Se:
 		return se(l)
+	case lk.Escolha:
+		return escolha(l)
 	case lk.Enquanto:
 		return enquanto(l)
+	case lk.Faca:
+		return prodSemicolon(l, faca)
 	case lk.Para:
 		return para(l)
 	case lk.Retorne:
 		return prodSemicolon(l, retorne)
-	case lk.Caractere, lk.Real, lk.Inteiro:
+	case lk.Pare, lk.Continue:
+		return prodSemicolon(l, consume)
+	case lk.Caractere, lk.Real, lk.Inteiro, lk.Cadeia, lk.Logico:
 		return prodSemicolon(l, varDecl)
 	}
 	if l.Word.Kind == lk.Ident {
@@ -177,8 +393,18 @@ func comando(l *lxr.Lexer) (*mod.Node, *Error) {
 		if err != nil {
 			return nil, err
 		}
-		if peeked.Kind == lk.Assign {
+		// indexar um vetor ou acessar um campo sem usar o valor
+		// não faz sentido, então 'ident [' e 'ident .' só podem
+		// ser o começo de uma atribuição
+		switch peeked.Kind {
+		case lk.Assign, lk.LeftBracket, lk.Dot,
+			lk.PlusAssign, lk.MinusAssign, lk.StarAssign,
+			lk.DivisionAssign, lk.RemainderAssign,
+			lk.Increment, lk.Decrement:
 			return prodSemicolon(l, atrib)
+		case lk.Ident:
+			// 'ident ident' declara uma variavel do tipo de um registro
+			return prodSemicolon(l, varDecl)
 		}
 	}
 	return prodSemicolon(l, expr)
@@ -198,14 +424,15 @@ func prodSemicolon(l *lxr.Lexer, prod production) (*mod.Node, *Error) {
 	return n, nil
 }
 
-// Retorne := "retorne" Expr.
+// Retorne := "retorne" [Expr].
+// a folha é nil quando não há expressão
 func retorne(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "retorne")
 	kw, err := expect(l, lk.Retorne)
 	if err != nil {
 		return nil, err
 	}
-	exp, err := expectProd(l, expr, "expressão")
+	exp, err := expr(l)
 	if err != nil {
 		return nil, err
 	}
@@ -275,7 +502,7 @@ func isMultOp(l *lex.Lexeme) bool {
 	return false
 }
 
-// Unary := [unaryOp] Termo [Call].
+// Unary := [unaryOp] Potencia.
 func unary(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "unary")
 	var op *mod.Node
@@ -286,10 +513,51 @@ func unary(l *lxr.Lexer) (*mod.Node, *Error) {
 			return nil, err
 		}
 	}
+	n, err := potencia(l)
+	if err != nil {
+		return nil, err
+	}
+	if op != nil {
+		op.Leaves = []*mod.Node{n}
+		return op, nil
+	}
+	return n, nil
+}
+
+// Potencia := Operando ['^' Unary].
+// '^' associa à direita e tem precedencia maior que os operadores unarios,
+// então '-2^2' é '-(2^2)' e '2^3^2' é '2^(3^2)'
+func potencia(l *lxr.Lexer) (*mod.Node, *Error) {
+	lxr.Track(l, "potencia")
+	n, err := operando(l)
+	if err != nil || n == nil || l.Word.Kind != lk.Caret {
+		return n, err
+	}
+	op, err := consume(l)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := expectProd(l, unary, "expressão unaria")
+	if err != nil {
+		return nil, err
+	}
+	op.Leaves = []*mod.Node{n, exp}
+	return op, nil
+}
+
+// Operando := Termo {Sufixo} [Call {Sufixo}].
+func operando(l *lxr.Lexer) (*mod.Node, *Error) {
+	lxr.Track(l, "operando")
 	n, err := termo(l)
 	if err != nil {
 		return nil, err
 	}
+	if n != nil {
+		n, err = sufixos(l, n)
+		if err != nil {
+			return nil, err
+		}
+	}
 	var c *mod.Node
 	if l.Word.Kind == lk.LeftParen {
 		c, err = call(l)
@@ -297,18 +565,11 @@ func unary(l *lxr.Lexer) (*mod.Node, *Error) {
 			return nil, err
 		}
 	}
-	// preguiça de fazer precedencia
 	if c != nil {
 		c.Leaves = append([]*mod.Node{n}, c.Leaves...)
-		if op != nil {
-			op.Leaves = []*mod.Node{c}
-			return op, nil
-		}
-		return c, nil
-	}
-	if op != nil {
-		op.Leaves = []*mod.Node{n}
-		return op, nil
+		// o resultado da chamada pode ser um registro,
+		// como em 'melhor(a, b).nota'
+		return sufixos(l, c)
 	}
 	return n, nil
 }
@@ -335,17 +596,80 @@ func call(l *lxr.Lexer) (*mod.Node, *Error) {
 	}, nil
 }
 
+// Sufixo := Index | Campo.
+func sufixos(l *lxr.Lexer, n *mod.Node) (*mod.Node, *Error) {
+	var err *Error
+	for {
+		switch l.Word.Kind {
+		case lk.LeftBracket:
+			n, err = index(l, n)
+		case lk.Dot:
+			n, err = campo(l, n)
+		default:
+			return n, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Campo := '.' ident.
+func campo(l *lxr.Lexer, reg *mod.Node) (*mod.Node, *Error) {
+	lxr.Track(l, "campo")
+	_, err := expect(l, lk.Dot)
+	if err != nil {
+		return nil, err
+	}
+	id, err := expect(l, lk.Ident)
+	if err != nil {
+		return nil, err
+	}
+	return &mod.Node{
+		Leaves: []*mod.Node{reg, id},
+		Kind:   nk.Field,
+	}, nil
+}
+
+// Index := '[' Expr ']'.
+func index(l *lxr.Lexer, vetor *mod.Node) (*mod.Node, *Error) {
+	lxr.Track(l, "index")
+	_, err := expect(l, lk.LeftBracket)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := expectProd(l, expr, "expressão")
+	if err != nil {
+		return nil, err
+	}
+	rb, err := expect(l, lk.RightBracket)
+	if err != nil {
+		return nil, err
+	}
+	// o intervalo começa no ']' e é estendido pelas folhas
+	rng := *rb.Range
+	return &mod.Node{
+		Leaves: []*mod.Node{vetor, exp},
+		Kind:   nk.Index,
+		Range:  &rng,
+	}, nil
+}
+
 /*
 Termo := literalInteiro
        | literalReal
        | literalCaracter
+       | mensagem
+       | 'verdadeiro'
+       | 'falso'
        | ident
        | '(' Expr ')'.
 */
 func termo(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "termo")
 	switch l.Word.Kind {
-	case lk.IntLit, lk.RealLit, lk.CharLit, lk.Ident:
+	case lk.IntLit, lk.RealLit, lk.CharLit, lk.StringLit,
+		lk.Verdadeiro, lk.Falso, lk.Ident:
 		return consume(l)
 	case lk.LeftParen:
 		_, err := consume(l)
@@ -370,18 +694,52 @@ func isUnaryOp(l *lex.Lexeme) bool {
 	return false
 }
 
-// Atrib := ident "=" Expr.
+/*
+Atrib := Alvo "=" Expr
+       | Alvo opAtrib Expr
+       | Alvo ("++" | "--").
+opAtrib := "+=" | "-=" | "*=" | "/=" | "%=".
+*/
 func atrib(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "atrib")
-	id, err := expect(l, lk.Ident)
+	id, err := alvo(l)
 	if err != nil {
 		return nil, err
 	}
+	switch l.Word.Kind {
+	case lk.PlusAssign, lk.MinusAssign, lk.StarAssign,
+		lk.DivisionAssign, lk.RemainderAssign:
+		op, err := consume(l)
+		if err != nil {
+			return nil, err
+		}
+		exp, err := expectProd(l, expr, "expressão")
+		if err != nil {
+			return nil, err
+		}
+		return desugarAtrib(op, id, exp), nil
+	case lk.Increment, lk.Decrement:
+		op, err := consume(l)
+		if err != nil {
+			return nil, err
+		}
+		one := &mod.Node{
+			Lexeme: &lex.Lexeme{
+				Text:  "1",
+				Kind:  lk.IntLit,
+				Value: int64(1),
+				Range: op.Lexeme.Range,
+			},
+			Leaves: []*mod.Node{},
+			Kind:   nk.Terminal,
+		}
+		return desugarAtrib(op, id, one), nil
+	}
 	ass, err := expect(l, lk.Assign)
 	if err != nil {
 		return nil, err
 	}
-	exp, err := expectProd(l, expr, "expression")
+	exp, err := expectProd(l, expr, "expressão")
 	if err != nil {
 		return nil, err
 	}
@@ -389,6 +747,68 @@ func atrib(l *lxr.Lexer) (*mod.Node, *Error) {
 	return ass, nil
 }
 
+// as atribuições compostas são só açucar: 'x += e' vira 'x = x + e',
+// e 'x++' vira 'x = x + 1', então seguem as mesmas regras de tipo.
+// Mas em 'v[f()] += 1' a chamada só acontece uma vez, veja mod.IsCompound
+func desugarAtrib(op, id, exp *mod.Node) *mod.Node {
+	bin := &mod.Node{
+		Lexeme: &lex.Lexeme{
+			Text:  binaryOp[op.Lexeme.Kind].String(),
+			Kind:  binaryOp[op.Lexeme.Kind],
+			Range: op.Lexeme.Range,
+		},
+		// o alvo é copiado pra que cada ocorrencia tenha seu proprio tipo
+		Leaves: []*mod.Node{cloneTree(id), exp},
+		Kind:   nk.Terminal,
+	}
+	op.Lexeme = &lex.Lexeme{
+		Text:  op.Lexeme.Text,
+		Kind:  lk.Assign,
+		Range: op.Lexeme.Range,
+	}
+	op.Leaves = []*mod.Node{id, bin}
+	return op
+}
+
+var binaryOp = map[lk.LexKind]lk.LexKind{
+	lk.PlusAssign:      lk.Plus,
+	lk.MinusAssign:     lk.Minus,
+	lk.StarAssign:      lk.Star,
+	lk.DivisionAssign:  lk.Division,
+	lk.RemainderAssign: lk.Remainder,
+	lk.Increment:       lk.Plus,
+	lk.Decrement:       lk.Minus,
+}
+
+func cloneTree(n *mod.Node) *mod.Node {
+	if n == nil {
+		return nil
+	}
+	out := &mod.Node{
+		Lexeme: n.Lexeme,
+		Leaves: make([]*mod.Node, len(n.Leaves)),
+		Kind:   n.Kind,
+	}
+	if n.Range != nil {
+		rng := *n.Range
+		out.Range = &rng
+	}
+	for i, leaf := range n.Leaves {
+		out.Leaves[i] = cloneTree(leaf)
+	}
+	return out
+}
+
+// Alvo := ident {Sufixo}.
+func alvo(l *lxr.Lexer) (*mod.Node, *Error) {
+	lxr.Track(l, "alvo")
+	n, err := expect(l, lk.Ident)
+	if err != nil {
+		return nil, err
+	}
+	return sufixos(l, n)
+}
+
 // Enquanto := 'enquanto' '(' Expr ')' Bloco.
 func enquanto(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "enquanto")
@@ -400,7 +820,7 @@ func enquanto(l *lxr.Lexer) (*mod.Node, *Error) {
 	if err != nil {
 		return nil, err
 	}
-	exp, err := expectProd(l, expr, "expression")
+	exp, err := expectProd(l, expr, "expressão")
 	if err != nil {
 		return nil, err
 	}
@@ -416,13 +836,48 @@ func enquanto(l *lxr.Lexer) (*mod.Node, *Error) {
 	return kw, nil
 }
 
-// Para := 'para' '(' [Atrib] term Expr term Atrib ')' Bloco.
+// Faca := 'faca' Bloco 'enquanto' '(' Expr ')'.
+func faca(l *lxr.Lexer) (*mod.Node, *Error) {
+	lxr.Track(l, "faca")
+	kw, err := expect(l, lk.Faca)
+	if err != nil {
+		return nil, err
+	}
+	bl, err := expectProd(l, bloco, "bloco")
+	if err != nil {
+		return nil, err
+	}
+	_, err = expect(l, lk.Enquanto)
+	if err != nil {
+		return nil, err
+	}
+	_, err = expect(l, lk.LeftParen)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := expectProd(l, expr, "expressão")
+	if err != nil {
+		return nil, err
+	}
+	_, err = expect(l, lk.RightParen)
+	if err != nil {
+		return nil, err
+	}
+	kw.Leaves = []*mod.Node{bl, exp}
+	return kw, nil
+}
+
+// Para := 'para' '(' [Atrib] term Expr term Atrib ')' Bloco
+//        | 'para' ParaDe.
 func para(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "para")
 	kw, err := expect(l, lk.Para)
 	if err != nil {
 		return nil, err
 	}
+	if l.Word.Kind == lk.Ident {
+		return paraDe(l, kw)
+	}
 	_, err = expect(l, lk.LeftParen)
 	if err != nil {
 		return nil, err
@@ -462,6 +917,50 @@ func para(l *lxr.Lexer) (*mod.Node, *Error) {
 	return kw, nil
 }
 
+// ParaDe := ident 'de' Expr 'ate' Expr ['passo' Expr] Bloco.
+// o passo é nil quando omitido
+func paraDe(l *lxr.Lexer, kw *mod.Node) (*mod.Node, *Error) {
+	lxr.Track(l, "paraDe")
+	id, err := expect(l, lk.Ident)
+	if err != nil {
+		return nil, err
+	}
+	_, err = expect(l, lk.De)
+	if err != nil {
+		return nil, err
+	}
+	inicio, err := expectProd(l, expr, "expressão")
+	if err != nil {
+		return nil, err
+	}
+	_, err = expect(l, lk.Ate)
+	if err != nil {
+		return nil, err
+	}
+	fim, err := expectProd(l, expr, "expressão")
+	if err != nil {
+		return nil, err
+	}
+	var passo *mod.Node
+	if l.Word.Kind == lk.Passo {
+		err = l.Next()
+		if err != nil {
+			return nil, err
+		}
+		passo, err = expectProd(l, expr, "expressão")
+		if err != nil {
+			return nil, err
+		}
+	}
+	bl, err := expectProd(l, bloco, "bloco")
+	if err != nil {
+		return nil, err
+	}
+	kw.Kind = nk.CountedLoop
+	kw.Leaves = []*mod.Node{id, inicio, fim, passo, bl}
+	return kw, nil
+}
+
 // Imprima := 'imprima' '(' ImpArg ')'.
 func imprima(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "imprima")
@@ -494,7 +993,7 @@ func impArg(l *lxr.Lexer) (*mod.Node, *Error) {
 	return expr(l)
 }
 
-// Leia := 'leia' '(' ident ')'.
+// Leia := 'leia' '(' Alvo ')'.
 func leia(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "leia")
 	kw, err := expect(l, lk.Leia)
@@ -505,7 +1004,7 @@ func leia(l *lxr.Lexer) (*mod.Node, *Error) {
 	if err != nil {
 		return nil, err
 	}
-	id, err := expect(l, lk.Ident)
+	id, err := alvo(l)
 	if err != nil {
 		return nil, err
 	}
@@ -528,7 +1027,7 @@ func se(l *lxr.Lexer) (*mod.Node, *Error) {
 	if err != nil {
 		return nil, err
 	}
-	exp, err := expectProd(l, expr, "expression")
+	exp, err := expectProd(l, expr, "expressão")
 	if err != nil {
 		return nil, err
 	}
@@ -552,6 +1051,110 @@ func se(l *lxr.Lexer) (*mod.Node, *Error) {
 	return kw, nil
 }
 
+// Escolha := 'escolha' '(' Expr ')' '{' {Caso} [OutroCaso] '}'.
+func escolha(l *lxr.Lexer) (*mod.Node, *Error) {
+	lxr.Track(l, "escolha")
+	kw, err := expect(l, lk.Escolha)
+	if err != nil {
+		return nil, err
+	}
+	_, err = expect(l, lk.LeftParen)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := expectProd(l, expr, "expressão")
+	if err != nil {
+		return nil, err
+	}
+	_, err = expect(l, lk.RightParen)
+	if err != nil {
+		return nil, err
+	}
+	_, err = expect(l, lk.LeftBrace)
+	if err != nil {
+		return nil, err
+	}
+	leaves := []*mod.Node{exp}
+	for l.Word.Kind == lk.Caso {
+		c, err := caso(l)
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, c)
+	}
+	if l.Word.Kind == lk.Outrocaso {
+		c, err := outrocaso(l)
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, c)
+	}
+	_, err = expect(l, lk.RightBrace)
+	if err != nil {
+		return nil, err
+	}
+	kw.Leaves = leaves
+	return kw, nil
+}
+
+// Caso := 'caso' ExprList ':' {Comando}.
+// os comandos ficam num bloco proprio, como se estivessem entre chaves
+func caso(l *lxr.Lexer) (*mod.Node, *Error) {
+	lxr.Track(l, "caso")
+	kw, err := expect(l, lk.Caso)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := repeatCommaList(l, expr)
+	if err != nil {
+		return nil, err
+	}
+	if labels == nil {
+		message := fmt.Sprintf("esperado expressão ao invés disso foi achado %v", l.Word.Kind)
+		return nil, newError(l, ek.ExpectedProd, message)
+	}
+	bl, err := casoBloco(l)
+	if err != nil {
+		return nil, err
+	}
+	exprList := &mod.Node{
+		Leaves: labels,
+		Kind:   nk.ExpressionList,
+	}
+	kw.Leaves = []*mod.Node{exprList, bl}
+	return kw, nil
+}
+
+// OutroCaso := 'outrocaso' ':' {Comando}.
+func outrocaso(l *lxr.Lexer) (*mod.Node, *Error) {
+	lxr.Track(l, "outrocaso")
+	kw, err := expect(l, lk.Outrocaso)
+	if err != nil {
+		return nil, err
+	}
+	bl, err := casoBloco(l)
+	if err != nil {
+		return nil, err
+	}
+	kw.Leaves = []*mod.Node{bl}
+	return kw, nil
+}
+
+func casoBloco(l *lxr.Lexer) (*mod.Node, *Error) {
+	_, err := expect(l, lk.Colon)
+	if err != nil {
+		return nil, err
+	}
+	cmds, err := comandos(l, lk.Caso, lk.Outrocaso, lk.RightBrace)
+	if err != nil {
+		return nil, err
+	}
+	return &mod.Node{
+		Leaves: cmds,
+		Kind:   nk.Block,
+	}, nil
+}
+
 // Senao := 'senao' Bloco.
 func senao(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "senao")
@@ -562,20 +1165,57 @@ func senao(l *lxr.Lexer) (*mod.Node, *Error) {
 	return expectProd(l, bloco, "bloco")
 }
 
-// VarDecl := tipo Idlist.
+// VarDecl := tipo DeclList.
 func varDecl(l *lxr.Lexer) (*mod.Node, *Error) {
 	lxr.Track(l, "varDecl")
 	t, err := expectType(l)
 	if err != nil {
 		return nil, err
 	}
-	idlist, err := repeatCommaList(l, ident)
+	idlist, err := repeatCommaList(l, declId)
+	if err != nil {
+		return nil, err
+	}
 	return &mod.Node{
 		Leaves: append([]*mod.Node{t}, idlist...),
 		Kind:   nk.VarDecl,
 	}, nil
 }
 
+// DeclId := ident {'[' literalInteiro ']'}.
+// os tamanhos de cada dimensão ficam como folhas do identificador
+func declId(l *lxr.Lexer) (*mod.Node, *Error) {
+	lxr.Track(l, "declId")
+	id, err := ident(l)
+	if err != nil || id == nil {
+		return id, err
+	}
+	err = declSizes(l, id)
+	if err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func declSizes(l *lxr.Lexer, id *mod.Node) *Error {
+	for l.Word.Kind == lk.LeftBracket {
+		_, err := consume(l)
+		if err != nil {
+			return err
+		}
+		size, err := expect(l, lk.IntLit)
+		if err != nil {
+			return err
+		}
+		_, err = expect(l, lk.RightBracket)
+		if err != nil {
+			return err
+		}
+		id.AddLeaf(size)
+	}
+	return nil
+}
+
 func ident(l *lxr.Lexer) (*mod.Node, *Error) {
 	if l.Word.Kind == lk.Ident {
 		return consume(l)
@@ -585,7 +1225,7 @@ func ident(l *lxr.Lexer) (*mod.Node, *Error) {
 
 func isType(l *lex.Lexeme) bool {
 	switch l.Kind {
-	case lk.Real, lk.Inteiro, lk.Caractere:
+	case lk.Real, lk.Inteiro, lk.Caractere, lk.Cadeia, lk.Logico:
 		return true
 	}
 	return false
@@ -631,8 +1271,9 @@ func check(l *lxr.Lexer, tpList ...lk.LexKind) *Error {
 	return err
 }
 
+// o identificador é o nome de um registro
 func expectType(l *lxr.Lexer) (*mod.Node, *Error) {
-	return expect(l, lk.Real, lk.Caractere, lk.Inteiro)
+	return expect(l, lk.Real, lk.Caractere, lk.Inteiro, lk.Cadeia, lk.Logico, lk.Ident)
 }
 
 func expect(l *lxr.Lexer, tpList ...lk.LexKind) (*mod.Node, *Error) {
@@ -700,30 +1341,6 @@ func repeatBinary(l *lxr.Lexer, prod production, name string, v validator) (*mod
 	return last, nil
 }
 
-/* repeat implements the following pattern
-for a given Production:
-
-	repeat := {Production}.
-*/
-func repeat(l *lxr.Lexer, prod production) ([]*mod.Node, *Error) {
-	out := []*mod.Node{}
-	n, err := prod(l)
-	if err != nil {
-		return nil, err
-	}
-	if n == nil {
-		return nil, nil
-	}
-	for n != nil {
-		out = append(out, n)
-		n, err = prod(l)
-		if err != nil {
-			return nil, err
-		}
-	}
-	return out, nil
-}
-
 // Implements the pattern:
 //    RepeatCommaList := Production {',' Production} [','].
 func repeatCommaList(l *lxr.Lexer, prod production) ([]*mod.Node, *Error) {
@@ -758,6 +1375,79 @@ func expectedEOF(l *lxr.Lexer) *Error {
 	return newError(l, ek.ExpectedEOF, "simbolo inesperado, esperado fim do arquivo (EOF)")
 }
 
+/*
+recoverFrom guarda o erro e descarta simbolos até o fim do comando
+onde ele aconteceu (panic mode): até um ';', que é consumido, ou até
+um '}' sem par, que fica pro bloco. Blocos dentro do comando são pulados
+inteiros, junto com um 'senao' logo depois deles.
+
+Erros do lexer não tem recuperação, e são retornados.
+*/
+func recoverFrom(l *lxr.Lexer, err *Error) *Error {
+	if err.Code == ek.InvalidSymbol {
+		return err
+	}
+	addError(l, err)
+	depth := 0
+	for l.Word.Kind != lk.EOF {
+		switch l.Word.Kind {
+		case lk.Semicolon:
+			if depth == 0 {
+				return l.Next()
+			}
+		case lk.LeftBrace:
+			depth++
+		case lk.RightBrace:
+			if depth == 0 {
+				return nil
+			}
+			depth--
+			if depth == 0 {
+				err := l.Next()
+				if err != nil || l.Word.Kind != lk.Senao {
+					return err
+				}
+			}
+		}
+		err := l.Next()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// só o primeiro erro de cada posição é guardado,
+// os outros costumam ser consequencia dele
+func addError(l *lxr.Lexer, err *Error) {
+	for _, other := range l.Errors {
+		if other.Location.Range.Begin == err.Location.Range.Begin {
+			return
+		}
+	}
+	l.Errors = append(l.Errors, err)
+}
+
+/*
+keywordHint sugere uma palavra chave quando o comando com erro
+começa com um nome parecido com uma, como em 'enquato (x < 3) {'.
+Só vale quando o erro aparece num '{', num nome ou numa palavra chave,
+que é onde o parser tropeça ao ler a palavra errada como um nome.
+*/
+func keywordHint(l *lxr.Lexer, err *Error, first *lex.Lexeme) {
+	if first.Kind != lk.Ident || err.Hint != "" {
+		return
+	}
+	if l.Word.Kind != lk.LeftBrace && l.Word.Kind != lk.Ident &&
+		!lxr.IsKeyword(l.Word.Text) {
+		return
+	}
+	kw := suggestion.Closest(first.Text, lxr.Keywords())
+	if kw != "" {
+		err.Hint = "'" + first.Text + "' parece a palavra chave '" + kw + "'"
+	}
+}
+
 func newError(l *lxr.Lexer, t ek.ErrorKind, message string) *Error {
 	return &Error{
 		Code:     t,
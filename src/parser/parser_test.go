@@ -0,0 +1,39 @@
+package parser
+
+import "testing"
+
+// cada programa tem um erro só, e a mensagem
+// deve apontar o que estava errado de verdade
+func TestErrorMessages(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Src     string
+		Message string
+	}{
+		{
+			"tamanho variavel",
+			"inteiro entrada() {\n\tinteiro v[n];\n\tretorne 0;\n}\n",
+			"esperado um de int lit: ao invés disso foi achado id",
+		},
+		{
+			"tamanho variavel depois da virgula",
+			"inteiro entrada() {\n\tinteiro a, v[n];\n\tretorne 0;\n}\n",
+			"esperado um de int lit: ao invés disso foi achado id",
+		},
+		{
+			"tamanho global",
+			"inteiro v[n];\ninteiro entrada() {\n\tretorne 0;\n}\n",
+			"esperado um de int lit: ao invés disso foi achado id",
+		},
+	}
+	for _, c := range cases {
+		_, errs := Parse("teste.uffp", c.Src)
+		if len(errs) != 1 {
+			t.Errorf("%v: esperado 1 erro, recebido %v", c.Name, errs)
+			continue
+		}
+		if errs[0].Message != c.Message {
+			t.Errorf("%v: esperado %q, recebido %q", c.Name, c.Message, errs[0].Message)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package pipelines
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -9,76 +10,231 @@ import (
 	lex "upt/core/lexeme"
 	mod "upt/core/module"
 
+	ek "upt/core/errorkind"
+	sv "upt/core/severity"
+
+	ir "github.com/padeir0/pir"
+
 	"upt/cgen"
+	"upt/debugger"
+	"upt/initialization"
+	"upt/interpreter"
 	"upt/lexer"
+	"upt/linearization"
 	"upt/parser"
 	"upt/resolution"
+	"upt/termination"
 	"upt/typechecker"
+	"upt/warnings"
 )
 
 // processes a single file and returns all tokens
 // or an error
-func Lexemes(file string) ([]*lex.Lexeme, *Error) {
+func Lexemes(file string) ([]*lex.Lexeme, ErrorList) {
 	s, err := getFile(file)
 	if err != nil {
-		return nil, err
+		return nil, ErrorList{err}
 	}
 	st := lexer.NewLexer(file, s)
-	return st.ReadAll()
+	lexemes, err := st.ReadAll()
+	if err != nil {
+		return nil, ErrorList{err}
+	}
+	return lexemes, nil
 }
 
 // processes a single file and returns it's AST
-// or an error
-func Ast(file string) (*mod.Node, *Error) {
+// or all syntax errors
+func Ast(file string) (*mod.Node, ErrorList) {
 	s, err := getFile(file)
 	if err != nil {
-		return nil, err
+		return nil, ErrorList{err}
 	}
 	return parser.Parse(file, s)
 }
 
-// TODO: REQ: generate CFG and do termination checking on procedures
 // processes a file and all it's dependencies
-// returns a typed Module or an error
-func Mod(file string) (*mod.Module, *Error) {
-	ast, err := Ast(file)
+// returns a typed Module or the errors of the first
+// stage that failed, warnings are reported to stderr
+func Mod(file string) (*mod.Module, ErrorList) {
+	Warnings = nil
+	s, err := getFile(file)
 	if err != nil {
-		return nil, err
+		return nil, ErrorList{err}
 	}
-	m, err := resolution.Resolve(file, ast)
-	if err != nil {
-		return nil, err
+	a := Analyse(file, s)
+	if a.Errors != nil {
+		// os avisos acham problemas antes das etapas que podem falhar,
+		// e os formatos json e sarif mostram eles junto dos erros
+		Warnings = a.Warnings
+		return nil, a.Errors
 	}
+	errs := reportWarnings(a.Module)
+	if errs != nil {
+		return nil, errs
+	}
+	return a.Module, nil
+}
 
-	err = typechecker.Check(m)
-	if err != nil {
-		return nil, err
+// Analysis é tudo que as etapas de Mod conseguiram construir,
+// mesmo quando uma delas falhou
+type Analysis struct {
+	Root   *mod.Node
+	Module *mod.Module // nil se a resolução falhou
+
+	// os avisos que não foram silenciados, e os erros da
+	// primeira etapa que falhou, ambos na ordem do arquivo
+	Warnings ErrorList
+	Errors   ErrorList
+}
+
+// Analyse roda as etapas de Mod sobre o texto de um arquivo,
+// sem escrever nada, é o que o servidor de LSP usa
+func Analyse(file string, contents string) *Analysis {
+	a := &Analysis{}
+	a.Root, a.Errors = parser.Parse(file, contents)
+	if a.Errors != nil {
+		return a.sorted()
 	}
-	return m, nil
+	m, errs := resolution.Resolve(file, a.Root)
+	if m == nil {
+		a.Errors = errs
+		return a.sorted()
+	}
+	a.Module = m
+
+	// os erros da resolução já estão em m.Errors, e os procedimentos
+	// que foram resolvidos ainda são tipados pra achar o resto dos erros
+	a.Errors = typechecker.Check(m)
+	if a.Errors != nil {
+		return a.sorted()
+	}
+	warnings.Check(m)
+	m.Warnings = silence(m.Warnings)
+	a.Warnings = m.Warnings
+
+	a.Errors = termination.Check(m)
+	if a.Errors != nil {
+		return a.sorted()
+	}
+	a.Errors = initialization.Check(m)
+	return a.sorted()
 }
 
-func GenC(file string) (string, *Error) {
-	m, err := Mod(file)
-	if err != nil {
-		return "", err
+func (this *Analysis) sorted() *Analysis {
+	this.Warnings.Sort()
+	this.Errors.Sort()
+	return this
+}
+
+// SilencedWarnings são os codigos de aviso que não são mostrados
+var SilencedWarnings = map[ek.ErrorKind]bool{}
+
+// WarningsAsErrors faz os avisos interromperem a compilação
+var WarningsAsErrors = false
+
+// PrintWarnings escreve os avisos em stderr assim que são encontrados,
+// desligado eles ficam só em Warnings, pra serem mostrados em outro formato
+var PrintWarnings = true
+
+// Warnings são os avisos da ultima compilação, em ordem
+var Warnings ErrorList
+
+func silence(warnings ErrorList) ErrorList {
+	shown := ErrorList{}
+	for _, w := range warnings {
+		if !SilencedWarnings[w.Code] {
+			shown = append(shown, w)
+		}
+	}
+	return shown
+}
+
+// reportWarnings mostra os avisos na ordem do arquivo,
+// ou retorna eles como erros se WarningsAsErrors estiver ligado
+func reportWarnings(m *mod.Module) ErrorList {
+	shown := m.Warnings
+	if len(shown) == 0 {
+		return nil
+	}
+	if WarningsAsErrors {
+		for _, w := range shown {
+			w.Severity = sv.Error
+		}
+		return shown
+	}
+	Warnings = shown
+	if !PrintWarnings {
+		return nil
+	}
+	for _, w := range shown {
+		os.Stderr.Write([]byte(w.String() + "\n"))
+	}
+	return nil
+}
+
+// processes a file and returns the linearized program
+// or the errors
+func IR(file string) (*ir.Program, ErrorList) {
+	m, errs := Mod(file)
+	if errs != nil {
+		return nil, errs
+	}
+	return linearization.Linearize(m), nil
+}
+
+func GenC(file string) (string, ErrorList) {
+	m, errs := Mod(file)
+	if errs != nil {
+		return "", errs
 	}
 	str := cgen.Gen(m)
 	return str, nil
 }
 
-func Compile(file string) (string, *Error) {
-	m, err := Mod(file)
-	if err != nil {
-		return "", err
+func Compile(file string) (string, ErrorList) {
+	m, errs := Mod(file)
+	if errs != nil {
+		return "", errs
 	}
 	str := cgen.Gen(m)
 	ioerr := genBinary(m.Name, str)
 	if ioerr != nil {
-		return "", ProcessFileError(ioerr)
+		return "", ErrorList{ProcessFileError(ioerr)}
 	}
 	return m.Name, nil
 }
 
+// processes a file and runs its linearized program,
+// returns the exit code of the program or the errors,
+// a runtime error also returns a non zero exit code
+func Run(file string, in io.Reader, out io.Writer) (int, ErrorList) {
+	m, errs := Mod(file)
+	if errs != nil {
+		return 0, errs
+	}
+	p := linearization.Linearize(m)
+	code, err := interpreter.RunProgram(m, p, in, out)
+	if err != nil {
+		return code, ErrorList{err}
+	}
+	return code, nil
+}
+
+// processes a file and runs it under the debugger,
+// returns the exit code of the program or the errors
+func Debug(file string, in io.Reader, out io.Writer) (int, ErrorList) {
+	m, errs := Mod(file)
+	if errs != nil {
+		return 0, errs
+	}
+	code, err := debugger.Debug(m, in, out)
+	if err != nil {
+		return code, ErrorList{err}
+	}
+	return code, nil
+}
+
 func genBinary(name, str string) error {
 	f, oserr := os.CreateTemp("", "upt_*.c")
 	if oserr != nil {
@@ -89,7 +245,8 @@ func genBinary(name, str string) error {
 	if oserr != nil {
 		return oserr
 	}
-	cmd := exec.Command("gcc", f.Name(), "-o", "./"+name)
+	// -lm liga a libm, usada por raiz, expo e '^'
+	cmd := exec.Command("gcc", f.Name(), "-o", "./"+name, "-lm")
 	_, oserr = cmd.Output()
 	if oserr != nil {
 		return oserr
@@ -0,0 +1,207 @@
+/*
+Package report converte erros e avisos para formatos que outros programas
+conseguem ler, como corretores automaticos e editores.
+Diferente do texto de Error.String, as linhas e colunas começam em 1,
+e o fim de um intervalo é a coluna logo depois do ultimo caractere.
+*/
+package report
+
+import (
+	"encoding/json"
+
+	core "upt/core"
+	sv "upt/core/severity"
+)
+
+// Diagnostic é um erro ou aviso no formato JSON
+type Diagnostic struct {
+	Code     string    `json:"code"`
+	Severity string    `json:"severity"`
+	Message  string    `json:"message"`
+	Hint     string    `json:"hint,omitempty"`
+	Location *Location `json:"location,omitempty"`
+	Notes    []*Note   `json:"notes,omitempty"`
+}
+
+type Location struct {
+	File  string    `json:"file"`
+	Begin *Position `json:"begin,omitempty"`
+	End   *Position `json:"end,omitempty"`
+}
+
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type Note struct {
+	Message  string    `json:"message"`
+	Location *Location `json:"location,omitempty"`
+}
+
+// JSON retorna uma lista com um objeto por diagnostico
+func JSON(errs core.ErrorList) ([]byte, error) {
+	out := []*Diagnostic{}
+	for _, err := range errs {
+		out = append(out, toDiagnostic(err))
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+func toDiagnostic(err *core.Error) *Diagnostic {
+	d := &Diagnostic{
+		Code:     err.ErrCode(),
+		Severity: err.Severity.String(),
+		Message:  err.Message,
+		Hint:     err.Hint,
+		Location: toLocation(err.Location),
+	}
+	for _, note := range err.Notes {
+		d.Notes = append(d.Notes, &Note{
+			Message:  note.Message,
+			Location: toLocation(note.Location),
+		})
+	}
+	return d
+}
+
+func toLocation(loc *core.Location) *Location {
+	if loc == nil {
+		return nil
+	}
+	out := &Location{File: loc.File}
+	if loc.Range != nil {
+		out.Begin = toPosition(loc.Range.Begin)
+		out.End = toPosition(loc.Range.End)
+	}
+	return out
+}
+
+func toPosition(p core.Position) *Position {
+	return &Position{Line: p.Line + 1, Column: p.Column + 1}
+}
+
+// SARIF segue a versão 2.1.0 do formato, usado por
+// ferramentas de analise estatica e pelo GitHub
+func SARIF(errs core.ErrorList) ([]byte, error) {
+	results := []*sarifResult{}
+	for _, err := range errs {
+		results = append(results, toResult(err))
+	}
+	log := &sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []*sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: "upt"}},
+			Results: results,
+		}},
+	}
+	return json.MarshalIndent(log, "", "  ")
+}
+
+type sarifLog struct {
+	Version string      `json:"version"`
+	Schema  string      `json:"$schema"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool      `json:"tool"`
+	Results []*sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name string `json:"name"`
+}
+
+type sarifResult struct {
+	RuleID           string           `json:"ruleId"`
+	Level            string           `json:"level"`
+	Message          sarifMessage     `json:"message"`
+	Locations        []*sarifLocation `json:"locations,omitempty"`
+	RelatedLocations []*sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	Message          *sarifMessage         `json:"message,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           *sarifRegion  `json:"region,omitempty"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+func toResult(err *core.Error) *sarifResult {
+	text := err.Message
+	if err.Hint != "" {
+		text += " (dica: " + err.Hint + ")"
+	}
+	res := &sarifResult{
+		RuleID:  err.ErrCode(),
+		Level:   toLevel(err.Severity),
+		Message: sarifMessage{Text: text},
+	}
+	if loc := toSarifLocation(err.Location); loc != nil {
+		res.Locations = []*sarifLocation{loc}
+	}
+	for _, note := range err.Notes {
+		loc := toSarifLocation(note.Location)
+		if loc != nil {
+			loc.Message = &sarifMessage{Text: note.Message}
+			res.RelatedLocations = append(res.RelatedLocations, loc)
+		}
+	}
+	return res
+}
+
+func toLevel(s sv.Severity) string {
+	switch s {
+	case sv.Warning:
+		return "warning"
+	case sv.Information, sv.Hint:
+		return "note"
+	}
+	return "error"
+}
+
+func toSarifLocation(loc *core.Location) *sarifLocation {
+	if loc == nil {
+		return nil
+	}
+	out := &sarifLocation{
+		PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifact{URI: loc.File},
+		},
+	}
+	if loc.Range != nil {
+		begin := toPosition(loc.Range.Begin)
+		end := toPosition(loc.Range.End)
+		out.PhysicalLocation.Region = &sarifRegion{
+			StartLine:   begin.Line,
+			StartColumn: begin.Column,
+			EndLine:     end.Line,
+			EndColumn:   end.Column,
+		}
+	}
+	return out
+}
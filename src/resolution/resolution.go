@@ -4,6 +4,7 @@ import (
 	. "upt/core"
 	mod "upt/core/module"
 	lexer "upt/lexer"
+	"upt/suggestion"
 
 	ek "upt/core/errorkind"
 	lk "upt/core/lexeme/lexkind"
@@ -15,55 +16,68 @@ import (
 	"strings"
 )
 
-func Resolve(fullpath string, root *mod.Node) (*mod.Module, *Error) {
+// Resolve continua depois de um erro, e retorna todos os que encontrar.
+// Se os erros estão só dentro de procedimentos, o modulo também é
+// retornado, com eles em M.Unresolved, para que o resto seja tipado.
+// Erros nas declarações globais, ou a falta de 'entrada', retornam
+// um modulo nil.
+func Resolve(fullpath string, root *mod.Node) (*mod.Module, ErrorList) {
 	name, err := extractName(fullpath)
 	if err != nil {
-		return nil, err
+		return nil, ErrorList{err}
 	}
 	ctx := newCtx(fullpath, name, root)
 
-	err = declareGlobals(ctx, root)
-	if err != nil {
-		return nil, err
-	}
-
-	err = resolveInnerScopes(ctx)
-	if err != nil {
-		return nil, err
-	}
-
+	declareGlobals(ctx, root)
 	sy := ctx.M.Global.Find("entrada")
 	if sy == nil {
-		return nil, errorEntryPointNotFound(ctx.M)
+		ctx.addError(errorEntryPointNotFound(ctx.M))
 	}
+	global := len(ctx.M.Errors) > 0
+
+	resolveInnerScopes(ctx)
 
-	return ctx.M, nil
+	if len(ctx.M.Errors) == 0 {
+		return ctx.M, nil
+	}
+	if global {
+		return nil, ctx.M.Errors
+	}
+	return ctx.M, ctx.M.Errors
 }
 
-func declareGlobals(ctx *context, root *mod.Node) *Error {
+func declareGlobals(ctx *context, root *mod.Node) {
+	var err *Error
 	for _, leaf := range root.Leaves {
-		if leaf.Kind != nk.Procedure {
+		switch leaf.Kind {
+		case nk.Procedure:
+			err = declareProc(ctx, leaf)
+		case nk.VarDecl:
+			err = declareGlobalVars(ctx, leaf)
+		case nk.Constant:
+			err = declareConst(ctx, leaf)
+		case nk.Record:
+			err = declareRecord(ctx, leaf)
+		default:
 			panic("invalid node kind for symbol")
 		}
-		err := declareProc(ctx, leaf)
 		if err != nil {
-			return err
+			ctx.addError(err)
 		}
 	}
-	return nil
 }
 
-func resolveInnerScopes(ctx *context) *Error {
+func resolveInnerScopes(ctx *context) {
 	for _, sy := range ctx.M.Global.Symbols {
 		if sy.Kind != sk.Procedure {
-			panic("invalid symbol kind")
+			continue
 		}
-		err := resolveProcScopes(ctx, sy)
-		if err != nil {
-			return err
+		before := len(ctx.M.Errors)
+		resolveProcScopes(ctx, sy)
+		if len(ctx.M.Errors) > before {
+			ctx.M.Unresolved[sy] = true
 		}
 	}
-	return nil
 }
 
 func extractName(filePath string) (string, *Error) {
@@ -82,6 +96,10 @@ func extractName(filePath string) (string, *Error) {
 type context struct {
 	M            *mod.Module
 	ScopeCounter int
+
+	// quantos laços envolvem o comando atual,
+	// 'pare' e 'continue' só são validos dentro de um
+	LoopDepth int
 }
 
 func newCtx(fullpath, name string, root *mod.Node) *context {
@@ -95,10 +113,20 @@ func newCtx(fullpath, name string, root *mod.Node) *context {
 				Parent:  mod.Universe,
 				Symbols: map[string]*mod.Symbol{},
 			},
+			Unresolved: map[*mod.Symbol]bool{},
 		},
+		// o escopo global já usa o 0
+		ScopeCounter: 1,
 	}
 }
 
+// addError guarda o erro e deixa a resolução continuar,
+// os nomes são declarados mesmo quando o tipo tem erro,
+// para que cada uso deles não vire um erro novo
+func (this *context) addError(err *Error) {
+	this.M.Errors = append(this.M.Errors, err)
+}
+
 func (this *context) NewScope(parent *mod.Scope) *mod.Scope {
 	id := this.ScopeCounter
 	this.ScopeCounter++
@@ -127,53 +155,173 @@ func declareProc(ctx *context, n *mod.Node) *Error {
 	return nil
 }
 
-func resolveProcScopes(ctx *context, sy *mod.Symbol) *Error {
+func declareGlobalVars(ctx *context, n *mod.Node) *Error {
+	// vardecl := {type, id...}
+	err := resolveType(ctx, ctx.M.Global, n.Leaves[0])
+	if err != nil {
+		ctx.addError(err)
+	}
+	for _, id := range n.Leaves[1:] {
+		name := id.Lexeme.Text
+		_, ok := ctx.M.Global.Symbols[name]
+		if ok {
+			ctx.addError(errorNameAlreadyDefined(ctx.M, id))
+			continue
+		}
+		sy := &mod.Symbol{
+			Kind:    sk.Global,
+			Name:    name,
+			N:       id,
+			Builtin: false,
+		}
+		ctx.M.Global.Add(name, sy)
+	}
+	return nil
+}
+
+// a expressão é resolvida antes da constante ser declarada,
+// então ela só pode usar os nomes declarados antes dela
+func declareConst(ctx *context, n *mod.Node) *Error {
+	// const := {type, id, expr}
+	id := n.Leaves[1]
+	name := id.Lexeme.Text
+	err := resolveType(ctx, ctx.M.Global, n.Leaves[0])
+	if err != nil {
+		ctx.addError(err)
+	}
+	err = resolveExpr(ctx, ctx.M.Global, n.Leaves[2])
+	if err != nil {
+		ctx.addError(err)
+	}
+	_, ok := ctx.M.Global.Symbols[name]
+	if ok {
+		return errorNameAlreadyDefined(ctx.M, id)
+	}
+	sy := &mod.Symbol{
+		Kind:    sk.Constant,
+		Name:    name,
+		N:       n,
+		Builtin: false,
+	}
+	ctx.M.Global.Add(name, sy)
+	return nil
+}
+
+// os tipos dos campos são resolvidos antes do registro ser declarado,
+// então um registro só pode conter registros declarados antes dele.
+// Os campos ficam num escopo proprio, guardado no nó do registro.
+func declareRecord(ctx *context, n *mod.Node) *Error {
+	// record := {id, vardecl...}
+	id := n.Leaves[0]
+	name := id.Lexeme.Text
+	fields := ctx.NewScope(nil)
+	for _, decl := range n.Leaves[1:] {
+		// vardecl := {type, id...}
+		err := resolveType(ctx, ctx.M.Global, decl.Leaves[0])
+		if err != nil {
+			ctx.addError(err)
+		}
+		for _, fieldId := range decl.Leaves[1:] {
+			fieldName := fieldId.Lexeme.Text
+			_, ok := fields.Symbols[fieldName]
+			if ok {
+				ctx.addError(errorNameAlreadyDefined(ctx.M, fieldId))
+				continue
+			}
+			fields.Add(fieldName, &mod.Symbol{
+				Kind:    sk.Field,
+				Name:    fieldName,
+				N:       fieldId,
+				Builtin: false,
+			})
+		}
+	}
+	n.Scope = fields
+
+	_, ok := ctx.M.Global.Symbols[name]
+	if ok {
+		return errorNameAlreadyDefined(ctx.M, id)
+	}
+	sy := &mod.Symbol{
+		Kind:    sk.Type,
+		Name:    name,
+		N:       n,
+		Builtin: false,
+	}
+	ctx.M.Global.Add(name, sy)
+	return nil
+}
+
+// resolveType só tem trabalho quando o tipo é o nome de um registro
+func resolveType(ctx *context, scope *mod.Scope, tipo *mod.Node) *Error {
+	if tipo == nil || tipo.Lexeme.Kind != lk.Ident {
+		return nil
+	}
+	sy := scope.Find(tipo.Lexeme.Text)
+	if sy == nil {
+		return errorSymbolNotDeclared(ctx.M, scope, tipo)
+	}
+	if sy.Kind != sk.Type {
+		return errorNotAType(ctx.M, tipo)
+	}
+	return nil
+}
+
+func resolveProcScopes(ctx *context, sy *mod.Symbol) {
 	argScope := ctx.NewScope(ctx.M.Global)
 	sy.N.Scope = argScope
 	argMap := []mod.Arg{}
 
 	// proc := {id, args, retNode, bl}
+	err := resolveType(ctx, ctx.M.Global, sy.N.Leaves[2])
+	if err != nil {
+		ctx.addError(err)
+	}
 	args := sy.N.Leaves[1]
 	if args != nil {
 		argMap = make([]mod.Arg, len(args.Leaves))
 		for i, arg := range args.Leaves {
-			// arg := {tipo, id}
+			// arg := {tipo, id, ref}
+			err := resolveType(ctx, ctx.M.Global, arg.Leaves[0])
+			if err != nil {
+				ctx.addError(err)
+			}
 			id := arg.Leaves[1]
 			name := id.Lexeme.Text
 			_, ok := argScope.Symbols[name]
 			if ok {
-				return errorNameAlreadyDefined(ctx.M, id)
+				ctx.addError(errorNameAlreadyDefined(ctx.M, id))
 			}
+			ref := arg.Leaves[2] != nil
 			sy := &mod.Symbol{
 				Kind:    sk.Argument,
 				Name:    name,
 				N:       arg,
 				Builtin: false,
+				Ref:     ref,
 			}
 			argScope.Add(name, sy)
 			argMap[i] = mod.Arg{
 				N:    arg,
 				Name: name,
 				Pos:  i,
+				Ref:  ref,
 			}
 		}
 	}
 	sy.Args = argMap
 	bl := sy.N.Leaves[3]
-	err := resolveBlock(ctx, argScope, bl)
-	if err != nil {
-		return err
-	}
-	return nil
+	resolveBlock(ctx, argScope, bl)
 }
 
+// um erro num comando não impede que os outros sejam resolvidos
 func resolveBlock(ctx *context, scope *mod.Scope, bl *mod.Node) *Error {
 	newScope := ctx.NewScope(scope)
 	bl.Scope = newScope
 	for _, cmd := range bl.Leaves {
 		err := resolveCmd(ctx, newScope, cmd)
 		if err != nil {
-			return err
+			ctx.addError(err)
 		}
 	}
 	return nil
@@ -191,13 +339,21 @@ func resolveCmd(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
 			return resolveSe(ctx, scope, n)
 		case lk.Enquanto:
 			return resolveEnquanto(ctx, scope, n)
+		case lk.Faca:
+			return resolveFaca(ctx, scope, n)
+		case lk.Escolha:
+			return resolveEscolha(ctx, scope, n)
 		case lk.Para:
 			return resolvePara(ctx, scope, n)
 		case lk.Retorne:
 			return resolveRetorne(ctx, scope, n)
+		case lk.Pare, lk.Continue:
+			return resolveSalto(ctx, n)
 		case lk.Assign:
 			return resolveAtrib(ctx, scope, n)
 		}
+	case nk.CountedLoop:
+		return resolveParaDe(ctx, scope, n)
 	case nk.Block:
 		return resolveBlock(ctx, scope, n)
 	case nk.VarDecl:
@@ -207,13 +363,7 @@ func resolveCmd(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
 }
 
 func resolveLeia(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
-	id := n.Leaves[0]
-	name := id.Lexeme.Text
-	sy := scope.Find(name)
-	if sy == nil {
-		return errorSymbolNotDeclared(ctx.M, id)
-	}
-	return nil
+	return resolveExpr(ctx, scope, n.Leaves[0])
 }
 
 func resolveImprima(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
@@ -230,55 +380,111 @@ func resolvePara(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
 	if initAtrib != nil {
 		err = resolveAtrib(ctx, scope, initAtrib)
 		if err != nil {
-			return err
+			ctx.addError(err)
 		}
 	}
 
 	expr := n.Leaves[1]
 	err = resolveExpr(ctx, scope, expr)
 	if err != nil {
-		return err
+		ctx.addError(err)
 	}
 
 	repeatAtrib := n.Leaves[2]
 	err = resolveAtrib(ctx, scope, repeatAtrib)
 	if err != nil {
-		return err
+		ctx.addError(err)
 	}
 
 	bl := n.Leaves[3]
-	return resolveBlock(ctx, scope, bl)
+	return resolveLoopBlock(ctx, scope, bl)
+}
+
+func resolveParaDe(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
+	// paraDe := {id, inicio, fim, passo, block}
+	for _, leaf := range n.Leaves[:4] {
+		if leaf == nil {
+			continue
+		}
+		err := resolveExpr(ctx, scope, leaf)
+		if err != nil {
+			ctx.addError(err)
+		}
+	}
+	bl := n.Leaves[4]
+	return resolveLoopBlock(ctx, scope, bl)
 }
 
 func resolveEnquanto(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
 	expr := n.Leaves[0]
 	err := resolveExpr(ctx, scope, expr)
 	if err != nil {
-		return err
+		ctx.addError(err)
 	}
 	bl := n.Leaves[1]
-	return resolveBlock(ctx, scope, bl)
+	return resolveLoopBlock(ctx, scope, bl)
+}
+
+// a condição fica fora do escopo do bloco, como em C
+func resolveFaca(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
+	bl := n.Leaves[0]
+	resolveLoopBlock(ctx, scope, bl)
+	expr := n.Leaves[1]
+	return resolveExpr(ctx, scope, expr)
+}
+
+func resolveLoopBlock(ctx *context, scope *mod.Scope, bl *mod.Node) *Error {
+	ctx.LoopDepth++
+	err := resolveBlock(ctx, scope, bl)
+	ctx.LoopDepth--
+	return err
+}
+
+// pare e continue não tem folhas,
+// só precisam estar dentro de um laço
+func resolveSalto(ctx *context, n *mod.Node) *Error {
+	if ctx.LoopDepth == 0 {
+		return errorOutsideLoop(ctx.M, n)
+	}
+	return nil
+}
+
+func resolveEscolha(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
+	// escolha := {expr, caso...}
+	err := resolveExpr(ctx, scope, n.Leaves[0])
+	if err != nil {
+		ctx.addError(err)
+	}
+	for _, c := range n.Leaves[1:] {
+		// caso := {labels, block}
+		// outrocaso := {block}
+		if c.Lexeme.Kind == lk.Caso {
+			for _, label := range c.Leaves[0].Leaves {
+				err = resolveExpr(ctx, scope, label)
+				if err != nil {
+					ctx.addError(err)
+				}
+			}
+		}
+		bl := c.Leaves[len(c.Leaves)-1]
+		resolveBlock(ctx, scope, bl)
+	}
+	return nil
 }
 
 func resolveSe(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
 	expr := n.Leaves[0]
 	err := resolveExpr(ctx, scope, expr)
 	if err != nil {
-		return err
+		ctx.addError(err)
 	}
 
 	bl := n.Leaves[1]
-	err = resolveBlock(ctx, scope, bl)
-	if err != nil {
-		return err
-	}
+	resolveBlock(ctx, scope, bl)
 
 	senao := n.Leaves[2]
 	if senao != nil {
-		err = resolveBlock(ctx, scope, senao)
-		if err != nil {
-			return err
-		}
+		resolveBlock(ctx, scope, senao)
 	}
 
 	return nil
@@ -286,16 +492,24 @@ func resolveSe(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
 
 func resolveRetorne(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
 	expr := n.Leaves[0]
+	if expr == nil {
+		return nil
+	}
 	return resolveExpr(ctx, scope, expr)
 }
 
 func resolveVarDecl(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
 	// vardecl := {type, id...}
+	err := resolveType(ctx, scope, n.Leaves[0])
+	if err != nil {
+		ctx.addError(err)
+	}
 	for _, id := range n.Leaves[1:] {
 		name := id.Lexeme.Text
 		sy := scope.Symbols[name]
 		if sy != nil {
-			return errorNameAlreadyDefined(ctx.M, id)
+			ctx.addError(errorNameAlreadyDefined(ctx.M, id))
+			continue
 		}
 		sy = &mod.Symbol{
 			Kind:    sk.Local,
@@ -314,7 +528,7 @@ func resolveExpr(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
 		switch n.Lexeme.Kind {
 		case lk.Ou, lk.E, lk.Equals, lk.Different,
 			lk.Greater, lk.GreaterOrEquals, lk.Less, lk.LessOrEquals,
-			lk.Plus, lk.Star, lk.Division, lk.Remainder:
+			lk.Plus, lk.Star, lk.Division, lk.Remainder, lk.Caret:
 			err := resolveExpr(ctx, scope, n.Leaves[0])
 			if err != nil {
 				return err
@@ -331,13 +545,17 @@ func resolveExpr(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
 				return err
 			}
 			return resolveExpr(ctx, scope, n.Leaves[1])
-		case lk.IntLit, lk.RealLit, lk.CharLit:
+		case lk.IntLit, lk.RealLit, lk.CharLit, lk.StringLit,
+			lk.Verdadeiro, lk.Falso:
 			return nil //nada pra fazer aqui
 		case lk.Ident:
 			name := n.Lexeme.Text
 			sy := scope.Find(name)
 			if sy == nil {
-				return errorSymbolNotDeclared(ctx.M, n)
+				return errorSymbolNotDeclared(ctx.M, scope, n)
+			}
+			if sy.Kind == sk.Type {
+				return errorTypeAsValue(ctx.M, n)
 			}
 			return nil
 		}
@@ -355,17 +573,25 @@ func resolveExpr(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
 			}
 		}
 		return nil
+	case nk.Index:
+		err := resolveExpr(ctx, scope, n.Leaves[0])
+		if err != nil {
+			return err
+		}
+		return resolveExpr(ctx, scope, n.Leaves[1])
+	case nk.Field:
+		// o campo só pode ser encontrado depois que
+		// o tipo do registro for conhecido
+		return resolveExpr(ctx, scope, n.Leaves[0])
 	}
 	fmt.Println(n)
 	panic("unreachable")
 }
 
 func resolveAtrib(ctx *context, scope *mod.Scope, n *mod.Node) *Error {
-	id := n.Leaves[0]
-	name := id.Lexeme.Text
-	sy := scope.Find(name)
-	if sy == nil {
-		return errorSymbolNotDeclared(ctx.M, id)
+	err := resolveExpr(ctx, scope, n.Leaves[0])
+	if err != nil {
+		return err
 	}
 	expr := n.Leaves[1]
 	return resolveExpr(ctx, scope, expr)
@@ -377,8 +603,38 @@ func errorNameAlreadyDefined(M *mod.Module, newName *mod.Node) *Error {
 	return mod.NewError(M, ek.NameAlreadyDefined, newName, "nome já pertence a outro simbolo")
 }
 
-func errorSymbolNotDeclared(M *mod.Module, n *mod.Node) *Error {
-	return mod.NewError(M, ek.SymbolNotDeclared, n, "simbolo '"+n.Lexeme.Text+"' não foi declarado")
+func errorSymbolNotDeclared(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
+	err := mod.NewError(M, ek.SymbolNotDeclared, n, "simbolo '"+n.Lexeme.Text+"' não foi declarado")
+	err.Hint = suggest(scope, n.Lexeme.Text)
+	return err
+}
+
+// suggest procura, entre os nomes visiveis no escopo e as
+// palavras chave, um parecido com o nome que não foi achado
+func suggest(scope *mod.Scope, name string) string {
+	candidates := lexer.Keywords()
+	for s := scope; s != nil; s = s.Parent {
+		for other := range s.Symbols {
+			candidates = append(candidates, other)
+		}
+	}
+	closest := suggestion.Closest(name, candidates)
+	if closest == "" {
+		return ""
+	}
+	return "você quis dizer '" + closest + "'?"
+}
+
+func errorNotAType(M *mod.Module, n *mod.Node) *Error {
+	return mod.NewError(M, ek.NotAType, n, "'"+n.Lexeme.Text+"' não é um tipo")
+}
+
+func errorTypeAsValue(M *mod.Module, n *mod.Node) *Error {
+	return mod.NewError(M, ek.NotAType, n, "'"+n.Lexeme.Text+"' é um tipo e não pode ser usado como valor")
+}
+
+func errorOutsideLoop(M *mod.Module, n *mod.Node) *Error {
+	return mod.NewError(M, ek.OutsideLoop, n, "'"+n.Lexeme.Text+"' só pode ser usado dentro de um laço")
 }
 
 func errorEntryPointNotFound(M *mod.Module) *Error {
@@ -0,0 +1,80 @@
+package suggestion
+
+import (
+	"sort"
+	"strings"
+)
+
+// Closest retorna o candidato mais parecido com o nome, ou ""
+// se nenhum estiver perto o bastante. A distancia aceita cresce
+// com o tamanho do nome: um erro a cada 3 letras, no minimo um.
+// Maiusculas e minusculas não contam como diferença, e nomes
+// completamente diferentes, como 'x' e 'e', nunca são sugeridos.
+func Closest(name string, candidates []string) string {
+	// as distancias contam letras, não bytes
+	size := len([]rune(name))
+	limit := size / 3
+	if limit < 1 {
+		limit = 1
+	}
+	// ordenar deixa a escolha deterministica nos empates
+	sorted := append([]string{}, candidates...)
+	sort.Strings(sorted)
+
+	best := ""
+	bestDist := limit + 1
+	lower := strings.ToLower(name)
+	for _, c := range sorted {
+		if c == name {
+			continue
+		}
+		d := Distance(lower, strings.ToLower(c))
+		// trocar o nome inteiro não é um erro de digitação
+		if d >= size || d >= len([]rune(c)) {
+			continue
+		}
+		if d < bestDist {
+			best = c
+			bestDist = d
+		}
+	}
+	return best
+}
+
+// Distance é a distancia de edição entre a e b: quantas inserções,
+// remoções, trocas ou transposições de letras vizinhas
+// são necessarias pra transformar um no outro
+func Distance(a, b string) int {
+	x, y := []rune(a), []rune(b)
+	// d[i][j] é a distancia entre x[:i] e y[:j]
+	d := make([][]int, len(x)+1)
+	for i := range d {
+		d[i] = make([]int, len(y)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && x[i-1] == y[j-2] && x[i-2] == y[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(x)][len(y)]
+}
+
+func min(a int, others ...int) int {
+	for _, b := range others {
+		if b < a {
+			a = b
+		}
+	}
+	return a
+}
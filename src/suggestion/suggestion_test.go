@@ -0,0 +1,58 @@
+package suggestion
+
+import "testing"
+
+func TestDistance(t *testing.T) {
+	cases := []struct {
+		A, B string
+		Dist int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"casa", "casa", 0},
+		{"casa", "cassa", 1},
+		{"casa", "cas", 1},
+		{"casa", "cama", 1},
+		// letras vizinhas trocadas contam uma vez só
+		{"enquanto", "enqaunto", 1},
+		{"kitten", "sitting", 3},
+		// a distancia conta letras, não bytes
+		{"ação", "acao", 2},
+		{"pé", "pe", 1},
+	}
+	for _, c := range cases {
+		if got := Distance(c.A, c.B); got != c.Dist {
+			t.Errorf("Distance(%q, %q) = %v, esperado %v", c.A, c.B, got, c.Dist)
+		}
+		if got := Distance(c.B, c.A); got != c.Dist {
+			t.Errorf("Distance(%q, %q) = %v, esperado %v", c.B, c.A, got, c.Dist)
+		}
+	}
+}
+
+func TestClosest(t *testing.T) {
+	cases := []struct {
+		Name       string
+		Candidates []string
+		Closest    string
+	}{
+		{"contdor", []string{"conta", "contador", "entrada"}, "contador"},
+		{"enqanto", []string{"enquanto", "entao", "escolha"}, "enquanto"},
+		{"Entrada", []string{"entrada"}, "entrada"},
+		// o proprio nome não é uma sugestão
+		{"a", []string{"a"}, ""},
+		// nomes curtos completamente diferentes
+		{"x", []string{"e", "y"}, ""},
+		{"soma", []string{"media", "total"}, ""},
+		// nos empates, a primeira em ordem alfabetica
+		{"caso", []string{"cast", "casa"}, "casa"},
+		// 'ação' tem 4 letras e 6 bytes, então aceita só um erro
+		{"ação", []string{"arco"}, ""},
+		{"ação", []string{"acão"}, "acão"},
+	}
+	for _, c := range cases {
+		if got := Closest(c.Name, c.Candidates); got != c.Closest {
+			t.Errorf("Closest(%q, %q) = %q, esperado %q", c.Name, c.Candidates, got, c.Closest)
+		}
+	}
+}
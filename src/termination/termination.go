@@ -0,0 +1,106 @@
+package termination
+
+import (
+	"upt/cfg"
+	. "upt/core"
+	mod "upt/core/module"
+	T "upt/core/types"
+
+	ek "upt/core/errorkind"
+	lk "upt/core/lexeme/lexkind"
+	nk "upt/core/module/nodekind"
+	sk "upt/core/module/symbolkind"
+)
+
+// Check verifica, para cada procedimento, se todos os caminhos
+// terminam em 'retorne'. Comandos inalcançaveis viram avisos
+// em M.Warnings. Retorna os erros de todos os procedimentos.
+func Check(M *mod.Module) ErrorList {
+	for _, sy := range M.Global.Symbols {
+		if sy.Kind != sk.Procedure || sy.Builtin {
+			continue
+		}
+		err := checkProc(M, sy)
+		if err != nil {
+			M.Errors = append(M.Errors, err)
+		}
+	}
+	return M.Errors
+}
+
+func checkProc(M *mod.Module, sy *mod.Symbol) *Error {
+	g := cfg.Build(sy)
+
+	// proc := {id, args, retNode, bl}
+	bl := sy.N.Leaves[3]
+	checkUnreachable(M, g, bl)
+
+	ret := sy.Type.Proc.Ret
+	if !T.IsVoid(ret) && g.Reachable(g.End) {
+		return errorMissingReturn(M, sy)
+	}
+	return nil
+}
+
+// checkUnreachable emite um unico aviso por sequencia de comandos
+// inalcançaveis: o primeiro comando morto de cada bloco
+func checkUnreachable(M *mod.Module, g *cfg.Graph, bl *mod.Node) {
+	for _, cmd := range bl.Leaves {
+		start, ok := g.Starts[cmd]
+		if ok && !g.Reachable(start) {
+			M.Warnings = append(M.Warnings, warningUnreachable(M, cmd))
+			return
+		}
+		for _, inner := range innerBlocks(cmd) {
+			checkUnreachable(M, g, inner)
+		}
+	}
+}
+
+func innerBlocks(n *mod.Node) []*mod.Node {
+	switch n.Kind {
+	case nk.Terminal:
+		switch n.Lexeme.Kind {
+		case lk.Se:
+			// se := {cond, block, senao}
+			if n.Leaves[2] != nil {
+				return []*mod.Node{n.Leaves[1], n.Leaves[2]}
+			}
+			return []*mod.Node{n.Leaves[1]}
+		case lk.Enquanto:
+			// enquanto := {cond, block}
+			return []*mod.Node{n.Leaves[1]}
+		case lk.Faca:
+			// faca := {block, cond}
+			return []*mod.Node{n.Leaves[0]}
+		case lk.Escolha:
+			// escolha := {expr, caso...}
+			out := []*mod.Node{}
+			for _, c := range n.Leaves[1:] {
+				out = append(out, c.Leaves[len(c.Leaves)-1])
+			}
+			return out
+		case lk.Para:
+			// para := {atrib, cond, atrib, block}
+			return []*mod.Node{n.Leaves[3]}
+		}
+	case nk.CountedLoop:
+		// paraDe := {id, inicio, fim, passo, block}
+		return []*mod.Node{n.Leaves[4]}
+	case nk.Block:
+		return []*mod.Node{n}
+	}
+	return nil
+}
+
+// errors -----------
+
+func errorMissingReturn(M *mod.Module, sy *mod.Symbol) *Error {
+	id := sy.N.Leaves[0]
+	msg := "o procedimento '" + sy.Name + "' pode terminar sem retornar um valor"
+	return mod.NewError(M, ek.MissingReturn, id, msg)
+}
+
+func warningUnreachable(M *mod.Module, n *mod.Node) *Error {
+	return mod.NewWarning(M, ek.UnreachableCode, n, "comando inalcançavel")
+}
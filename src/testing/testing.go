@@ -1,10 +1,14 @@
 package testing
 
 import (
+	"bytes"
+	"strconv"
 	"strings"
 
 	. "upt/core"
 	et "upt/core/errorkind"
+	"upt/interpreter"
+	"upt/linearization"
 	"upt/pipelines"
 
 	"fmt"
@@ -17,11 +21,24 @@ import (
 // seeing if they exit normally
 //
 // the test data is located directly in the name
-// of the file:
+// of the file, and is compared with the first error
+// in the file:
 // 	module_name.E001.uffp
 // 	            ^ error code
 // 	module_name.uffp
 // 	           ^ no error code (file must exit normally)
+// 	module_name.W002.uffp
+// 	            ^ warning code (warnings are treated as errors)
+// 	module_name.E018.uffp
+// 	            ^ runtime error, the compiled program must exit with 1
+//
+// files that expect an error can also pin its hint
+// with a comment anywhere in the file:
+// 	// dica: você quis dizer 'contador'?
+//
+// or every error reported, in file order, as 'code:line'
+// with lines counted from 1, as in the json format:
+// 	// erros: E006:4 E006:6 E009:11
 
 type TestResult struct {
 	File    string
@@ -40,8 +57,10 @@ func (res *TestResult) String() string {
 func PartialTest(file string) TestResult {
 	defer recoverIfFatal(file)
 	expectedErr := extractError(file)
+	defer expectWarning(expectedErr)()
 
-	_, err := pipelines.Mod(file)
+	_, errs := pipelines.Mod(file)
+	err := errs.First()
 
 	if err != nil {
 		if err.Code == et.InternalCompilerError {
@@ -51,7 +70,7 @@ func PartialTest(file string) TestResult {
 				Message: err.Message,
 			}
 		}
-		return compareError(file, err, expectedErr)
+		return compareError(file, errs, expectedErr)
 	}
 	return TestResult{
 		File: file,
@@ -62,8 +81,10 @@ func PartialTest(file string) TestResult {
 func Test(file string) TestResult {
 	defer recoverIfFatal(file)
 	expectedErr := extractError(file)
+	defer expectWarning(expectedErr)()
 
-	name, err := pipelines.Compile(file)
+	name, errs := pipelines.Compile(file)
+	err := errs.First()
 
 	if err != nil {
 		if err.Code == et.InternalCompilerError {
@@ -73,12 +94,15 @@ func Test(file string) TestResult {
 				Message: err.Message,
 			}
 		}
-		return compareError(file, err, expectedErr)
+		return compareError(file, errs, expectedErr)
 	}
 
 	defer os.Remove("./" + name)
 
 	oserror := execWithTimeout("./" + name)
+	if expectedErr == et.RuntimeError.String() {
+		return compareRuntimeError(file, oserror)
+	}
 	if oserror != nil {
 		return newResult(file, ProcessFileError(oserror))
 	}
@@ -88,6 +112,76 @@ func Test(file string) TestResult {
 	}
 }
 
+// o C gerado mostra o erro e sai com 1, não há um *Error pra comparar
+func compareRuntimeError(file string, oserror error) TestResult {
+	exitErr, ok := oserror.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 1 {
+		msg := "expected error " + et.RuntimeError.String() + " (exit status 1), instead found "
+		if oserror == nil {
+			msg += "nothing"
+		} else {
+			msg += oserror.Error()
+		}
+		return TestResult{
+			File:    file,
+			Message: msg,
+			Ok:      false,
+		}
+	}
+	return TestResult{
+		File: file,
+		Ok:   true,
+	}
+}
+
+// same as Test, but runs the program in the interpreter
+// instead of compiling it
+func Interpret(file string) TestResult {
+	defer recoverIfFatal(file)
+	expectedErr := extractError(file)
+	defer expectWarning(expectedErr)()
+
+	m, errs := pipelines.Mod(file)
+	err := errs.First()
+	if err == nil {
+		var out bytes.Buffer
+		var code int
+		p := linearization.Linearize(m)
+		code, err = interpreter.RunProgramWithTimeout(m, p, &bytes.Buffer{}, &out, 1*time.Second)
+		if err == nil && code != 0 {
+			return TestResult{
+				File:    file,
+				Ok:      false,
+				Message: "exit status " + strconv.Itoa(code),
+			}
+		}
+		if err != nil {
+			errs = ErrorList{err}
+		}
+	}
+
+	if err != nil && err.Code == et.InternalCompilerError {
+		return TestResult{
+			File:    file,
+			Ok:      false,
+			Message: err.Message,
+		}
+	}
+	return compareError(file, errs, expectedErr)
+}
+
+// expectWarning turns warnings into errors while testing
+// a file that expects a warning, the returned func undoes it
+func expectWarning(expectedErr string) func() {
+	old := pipelines.WarningsAsErrors
+	if strings.HasPrefix(expectedErr, "W") {
+		pipelines.WarningsAsErrors = true
+	}
+	return func() {
+		pipelines.WarningsAsErrors = old
+	}
+}
+
 func execWithTimeout(cmdstr string) error {
 	cmd := exec.Command(cmdstr)
 	if err := cmd.Start(); err != nil {
@@ -118,7 +212,8 @@ func extractError(file string) string {
 	return err
 }
 
-func compareError(file string, err *Error, expectedErr string) TestResult {
+func compareError(file string, errs ErrorList, expectedErr string) TestResult {
+	err := errs.First()
 	if err != nil && expectedErr == "" {
 		msg := "expected no errors, instead found: " +
 			err.ErrCode()
@@ -146,6 +241,72 @@ func compareError(file string, err *Error, expectedErr string) TestResult {
 				Ok:      false,
 			}
 		}
+		res := compareHint(file, err)
+		if !res.Ok {
+			return res
+		}
+		return compareList(file, errs)
+	}
+	return TestResult{
+		File: file,
+		Ok:   true,
+	}
+}
+
+const hintPrefix = "// dica: "
+
+func compareHint(file string, err *Error) TestResult {
+	pins, ioerr := readPins(file, hintPrefix)
+	if ioerr != nil {
+		return newResult(file, ioerr)
+	}
+	for _, expected := range pins {
+		if err.Hint != expected {
+			return TestResult{
+				File:    file,
+				Message: "expected hint " + strconv.Quote(expected) + ", instead found " + strconv.Quote(err.Hint),
+				Ok:      false,
+			}
+		}
+	}
+	return TestResult{
+		File: file,
+		Ok:   true,
+	}
+}
+
+const listPrefix = "// erros: "
+
+// compareList compara todos os erros, na ordem do arquivo,
+// com a lista 'codigo:linha' do comentario
+func compareList(file string, errs ErrorList) TestResult {
+	pins, ioerr := readPins(file, listPrefix)
+	if ioerr != nil {
+		return newResult(file, ioerr)
+	}
+	if len(pins) == 0 {
+		return TestResult{
+			File: file,
+			Ok:   true,
+		}
+	}
+	sorted := append(ErrorList{}, errs...)
+	sorted.Sort()
+	actual := []string{}
+	for _, err := range sorted {
+		line := 0
+		if err.Location != nil && err.Location.Range != nil {
+			line = err.Location.Range.Begin.Line + 1
+		}
+		actual = append(actual, err.ErrCode()+":"+strconv.Itoa(line))
+	}
+	expected := strings.Join(pins, " ")
+	if strings.Join(actual, " ") != expected {
+		return TestResult{
+			File:    file,
+			Message: "expected errors [" + expected + "], instead found [" + strings.Join(actual, " ") + "]",
+			Ok:      false,
+		}
 	}
 	return TestResult{
 		File: file,
@@ -153,6 +314,22 @@ func compareError(file string, err *Error, expectedErr string) TestResult {
 	}
 }
 
+// readPins retorna o resto das linhas do arquivo que começam com prefix
+func readPins(file string, prefix string) ([]string, *Error) {
+	contents, ioerr := os.ReadFile(file)
+	if ioerr != nil {
+		return nil, ProcessFileError(ioerr)
+	}
+	pins := []string{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, prefix) {
+			pins = append(pins, strings.TrimSpace(strings.TrimPrefix(line, prefix)))
+		}
+	}
+	return pins, nil
+}
+
 func newResult(file string, e *Error) TestResult {
 	return TestResult{
 		File:    file,
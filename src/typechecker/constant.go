@@ -0,0 +1,243 @@
+package typechecker
+
+import (
+	. "upt/core"
+	mod "upt/core/module"
+	T "upt/core/types"
+
+	ek "upt/core/errorkind"
+	lk "upt/core/lexeme/lexkind"
+	nk "upt/core/module/nodekind"
+	sk "upt/core/module/symbolkind"
+
+	"math"
+)
+
+// evalConst calcula o valor de uma expressão constante em tempo
+// de compilação, os tipos dos nós já foram definidos por checkExpr.
+// O valor é um int64 (inteiro e caractere), float64, bool ou string,
+// cadeias são guardadas como escritas no fonte, sem as aspas.
+func evalConst(M *mod.Module, scope *mod.Scope, n *mod.Node) (interface{}, *Error) {
+	if n.Kind != nk.Terminal {
+		return nil, errorNotConstant(M, n)
+	}
+	switch n.Lexeme.Kind {
+	case lk.IntLit, lk.CharLit, lk.RealLit:
+		return n.Lexeme.Value, nil
+	case lk.StringLit:
+		text := n.Lexeme.Text
+		return text[1 : len(text)-1], nil
+	case lk.Verdadeiro:
+		return true, nil
+	case lk.Falso:
+		return false, nil
+	case lk.Ident:
+		sy := scope.Find(n.Lexeme.Text)
+		if sy.Kind != sk.Constant {
+			return nil, errorNotConstant(M, n)
+		}
+		return sy.Value, nil
+	case lk.Nao:
+		a, err := evalConst(M, scope, n.Leaves[0])
+		if err != nil {
+			return nil, err
+		}
+		return !constToBool(a), nil
+	case lk.Minus:
+		if len(n.Leaves) == 1 {
+			a, err := evalConst(M, scope, n.Leaves[0])
+			if err != nil {
+				return nil, err
+			}
+			if n.T.Basic == T.Real {
+				return -constToReal(a), nil
+			}
+			return wrapConst(-a.(int64), n.T), nil
+		}
+		return evalConstArith(M, scope, n)
+	case lk.Plus, lk.Star, lk.Division, lk.Remainder, lk.Caret:
+		return evalConstArith(M, scope, n)
+	case lk.E, lk.Ou:
+		a, b, err := evalConstOperands(M, scope, n)
+		if err != nil {
+			return nil, err
+		}
+		if n.Lexeme.Kind == lk.E {
+			return constToBool(a) && constToBool(b), nil
+		}
+		return constToBool(a) || constToBool(b), nil
+	case lk.Equals, lk.Different,
+		lk.Greater, lk.GreaterOrEquals, lk.Less, lk.LessOrEquals:
+		return evalConstComparison(M, scope, n)
+	}
+	return nil, errorNotConstant(M, n)
+}
+
+func evalConstOperands(M *mod.Module, scope *mod.Scope, n *mod.Node) (interface{}, interface{}, *Error) {
+	a, err := evalConst(M, scope, n.Leaves[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := evalConst(M, scope, n.Leaves[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, b, nil
+}
+
+func evalConstArith(M *mod.Module, scope *mod.Scope, n *mod.Node) (interface{}, *Error) {
+	a, b, err := evalConstOperands(M, scope, n)
+	if err != nil {
+		return nil, err
+	}
+	if n.T.Basic == T.Real {
+		x, y := constToReal(a), constToReal(b)
+		switch n.Lexeme.Kind {
+		case lk.Plus:
+			return x + y, nil
+		case lk.Minus:
+			return x - y, nil
+		case lk.Star:
+			return x * y, nil
+		case lk.Division:
+			return x / y, nil
+		case lk.Caret:
+			return math.Pow(x, y), nil
+		}
+		panic("unreachable")
+	}
+	x, y := a.(int64), b.(int64)
+	var out int64
+	switch n.Lexeme.Kind {
+	case lk.Plus:
+		out = x + y
+	case lk.Minus:
+		out = x - y
+	case lk.Star:
+		out = x * y
+	case lk.Caret:
+		out = int64(math.Pow(float64(x), float64(y)))
+	case lk.Division, lk.Remainder:
+		if y == 0 {
+			return nil, errorConstDivisionByZero(M, n)
+		}
+		if n.Lexeme.Kind == lk.Division {
+			out = x / y
+		} else {
+			out = x % y
+		}
+	}
+	return wrapConst(out, n.T), nil
+}
+
+func evalConstComparison(M *mod.Module, scope *mod.Scope, n *mod.Node) (interface{}, *Error) {
+	a, b, err := evalConstOperands(M, scope, n)
+	if err != nil {
+		return nil, err
+	}
+	switch a.(type) {
+	case string, bool:
+		// só '==' e '!=' são permitidos nesses tipos
+		equal := a == b
+		if n.Lexeme.Kind == lk.Different {
+			return !equal, nil
+		}
+		return equal, nil
+	}
+	var cmp int
+	x, okX := a.(int64)
+	y, okY := b.(int64)
+	if okX && okY {
+		cmp = compareConstInt(x, y)
+	} else {
+		cmp = compareConst(constToReal(a), constToReal(b))
+	}
+	switch n.Lexeme.Kind {
+	case lk.Equals:
+		return cmp == 0, nil
+	case lk.Different:
+		return cmp != 0, nil
+	case lk.Greater:
+		return cmp > 0, nil
+	case lk.GreaterOrEquals:
+		return cmp >= 0, nil
+	case lk.Less:
+		return cmp < 0, nil
+	case lk.LessOrEquals:
+		return cmp <= 0, nil
+	}
+	panic("unreachable")
+}
+
+func compareConstInt(a, b int64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareConst(a, b float64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// convertConst converte o valor para o tipo declarado da constante
+func convertConst(v interface{}, t *T.Type) interface{} {
+	switch t.Basic {
+	case T.Real:
+		return constToReal(v)
+	case T.Inteiro, T.Caractere:
+		return wrapConst(v.(int64), t)
+	}
+	return v
+}
+
+func constToReal(v interface{}) float64 {
+	switch x := v.(type) {
+	case int64:
+		return float64(x)
+	case float64:
+		return x
+	}
+	panic("unreachable")
+}
+
+// no modo de compatibilidade, inteiros podem ser usados como logicos
+func constToBool(v interface{}) bool {
+	switch x := v.(type) {
+	case bool:
+		return x
+	case int64:
+		return x != 0
+	}
+	panic("unreachable")
+}
+
+// wrapConst trunca o valor pro tamanho do tipo em C
+func wrapConst(i int64, t *T.Type) int64 {
+	switch t.Basic {
+	case T.Inteiro:
+		return int64(int32(i))
+	case T.Caractere:
+		return int64(int8(i))
+	}
+	return i
+}
+
+// errors -----------
+
+func errorNotConstant(M *mod.Module, n *mod.Node) *Error {
+	return mod.NewError(M, ek.InvalidConstant, n, "expressão não pode ser calculada em tempo de compilação")
+}
+
+func errorConstDivisionByZero(M *mod.Module, n *mod.Node) *Error {
+	return mod.NewError(M, ek.InvalidConstant, n, "divisão por zero em expressão constante")
+}
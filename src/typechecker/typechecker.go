@@ -10,62 +10,143 @@ import (
 	lk "upt/core/lexeme/lexkind"
 	nk "upt/core/module/nodekind"
 	sk "upt/core/module/symbolkind"
+
+	"fmt"
 )
 
-func Check(M *mod.Module) *Error {
-	err := inferGlobals(M)
-	if err != nil {
-		return err
-	}
+// Check continua depois de um erro, e retorna todos os que encontrar
+func Check(M *mod.Module) ErrorList {
+	inferGlobals(M)
 	sy := M.Global.Find("entrada")
-	if !sy.Type.Equals(T.T_Entrada) {
-		return errorWrongEntryType(M, sy.N)
+	if sy.Type != nil && !sy.Type.Equals(T.T_Entrada) {
+		addError(M, errorWrongEntryType(M, sy.N))
 	}
+	checkInnerScopes(M)
+	return M.Errors
+}
 
-	err = checkInnerScopes(M)
-	if err != nil {
-		return err
+// addError guarda o erro e deixa a checagem continuar.
+// Quando a declaração de um simbolo tem erro, o tipo dele fica nil
+// e cada uso retorna errSilenced, que não é guardado
+func addError(M *mod.Module, err *Error) {
+	if err == nil || err == errSilenced {
+		return
 	}
+	M.Errors = append(M.Errors, err)
+}
 
-	return nil
+// CompatibilityMode faz as condições e os operadores
+// 'e', 'ou' e 'nao' aceitarem inteiros, como em C
+var CompatibilityMode = false
+
+func isCondition(t *T.Type) bool {
+	if CompatibilityMode && T.T_Inteiro.Equals(t) {
+		return true
+	}
+	return T.IsLogico(t)
 }
 
-func inferGlobals(M *mod.Module) *Error {
+func inferGlobals(M *mod.Module) {
+	// registros vem primeiro já que podem ser usados por todo o resto,
+	// e na ordem em que aparecem já que um pode conter os anteriores
+	for _, n := range M.Root.Leaves {
+		if n.Kind != nk.Record {
+			continue
+		}
+		inferRecord(M, n)
+	}
 	for _, sy := range M.Global.Symbols {
-		if sy.Kind != sk.Procedure {
-			panic("invalid node kind for symbol")
+		if sy.Kind != sk.Procedure || M.Unresolved[sy] {
+			continue
 		}
-		err := inferProc(M, sy)
-		if err != nil {
-			return err
+		inferProc(M, sy)
+	}
+	// constantes são calculadas na ordem em que aparecem,
+	// já que uma pode depender das anteriores
+	var err *Error
+	for _, n := range M.Root.Leaves {
+		switch n.Kind {
+		case nk.VarDecl:
+			err = checkVarDecl(M, M.Global, n)
+		case nk.Constant:
+			err = checkConst(M, n)
 		}
+		addError(M, err)
+	}
+}
+
+func checkConst(M *mod.Module, n *mod.Node) *Error {
+	// const := {type, id, expr}
+	tNode := n.Leaves[0]
+	t := t2T(M, tNode)
+	tNode.T = t
+	id := n.Leaves[1]
+	expr := n.Leaves[2]
+	err := checkExpr(M, M.Global, expr)
+	if err != nil {
+		return err
+	}
+	if !T.IsValue(t) || !T.Assignable(t, expr.T) {
+		return errorVarNotAssignable(M, n, expr.T, t)
+	}
+	v, err := evalConst(M, M.Global, expr)
+	if err != nil {
+		return err
 	}
+	sy := M.Global.Symbols[id.Lexeme.Text]
+	id.T = t
+	sy.Type = t
+	sy.Value = convertConst(v, t)
 	return nil
 }
 
-func checkInnerScopes(M *mod.Module) *Error {
-	for _, sy := range M.Global.Symbols {
-		if sy.Kind != sk.Procedure {
-			panic("invalid symbol kind")
+// um campo com erro fica sem tipo, mas o registro ainda ganha um
+func inferRecord(M *mod.Module, n *mod.Node) {
+	// record := {id, vardecl...}
+	id := n.Leaves[0]
+	sy := M.Global.Symbols[id.Lexeme.Text]
+	t := T.NewRecordType(sy.Name)
+	for _, decl := range n.Leaves[1:] {
+		// vardecl := {type, id...}
+		tNode := decl.Leaves[0]
+		fieldT := t2T(M, tNode)
+		tNode.T = fieldT
+		for _, fieldId := range decl.Leaves[1:] {
+			idT, err := declType(M, fieldT, fieldId)
+			addError(M, err)
+			fieldId.T = idT
+			n.Scope.Symbols[fieldId.Lexeme.Text].Type = idT
+			t.Record.Fields = append(t.Record.Fields, &T.Field{
+				Name: fieldId.Lexeme.Text,
+				T:    idT,
+			})
 		}
-		err := checkProc(M, sy)
-		if err != nil {
-			return err
+	}
+	id.T = t
+	sy.Type = t
+}
+
+// os procedimentos com erros de resolução ficam sem tipo,
+// então as chamadas a eles também não geram erros novos
+func checkInnerScopes(M *mod.Module) {
+	for _, sy := range M.Global.Symbols {
+		if sy.Kind != sk.Procedure || M.Unresolved[sy] {
+			continue
 		}
+		checkProc(M, sy)
 	}
-	return nil
 }
 
-func inferProc(M *mod.Module, sy *mod.Symbol) *Error {
+func inferProc(M *mod.Module, sy *mod.Symbol) {
 	// proc := {id, args, retNode, bl}
 	scope := sy.N.Scope
 	args := sy.N.Leaves[1]
 	argTypes := []*T.Type{}
 	if args != nil {
 		for i, arg := range args.Leaves {
-			// arg := {tipo, id}
+			// arg := {tipo, id, ref}
 			tnode := arg.Leaves[0]
-			t := t2T(tnode)
+			t := t2T(M, tnode)
 
 			id := arg.Leaves[1]
 			name := id.Lexeme.Text
@@ -78,44 +159,46 @@ func inferProc(M *mod.Module, sy *mod.Symbol) *Error {
 	retNode := sy.N.Leaves[2]
 	var retType *T.Type
 	if retNode != nil {
-		retType = t2T(retNode)
+		retType = t2T(M, retNode)
 	} else {
 		retType = T.T_Inteiro
 	}
 
 	sy.Type = T.NewProcType(argTypes, retType)
-	return nil
 }
 
-func t2T(n *mod.Node) *T.Type {
+// registros só podem ser declarados no escopo global
+func t2T(M *mod.Module, n *mod.Node) *T.Type {
 	switch n.Lexeme.Kind {
+	case lk.Ident:
+		return M.Global.Find(n.Lexeme.Text).Type
 	case lk.Caractere:
 		return T.T_Caractere
 	case lk.Real:
 		return T.T_Real
 	case lk.Inteiro:
 		return T.T_Inteiro
+	case lk.Cadeia:
+		return T.T_String
+	case lk.Logico:
+		return T.T_Logico
+	case lk.Vazio:
+		return T.T_Void
 	}
 	panic("invalid type")
 }
 
-func checkProc(M *mod.Module, sy *mod.Symbol) *Error {
+func checkProc(M *mod.Module, sy *mod.Symbol) {
 	scope := sy.N.Scope
 	bl := sy.N.Leaves[3]
-	err := checkBlock(M, sy, scope, bl)
-	if err != nil {
-		return err
-	}
-	return nil
+	checkBlock(M, sy, scope, bl)
 }
 
+// um erro num comando não impede que os outros sejam checados
 func checkBlock(M *mod.Module, sy *mod.Symbol, scope *mod.Scope, bl *mod.Node) *Error {
 	scope = bl.Scope
 	for _, cmd := range bl.Leaves {
-		err := checkCmd(M, sy, scope, cmd)
-		if err != nil {
-			return err
-		}
+		addError(M, checkCmd(M, sy, scope, cmd))
 	}
 	return nil
 }
@@ -132,26 +215,48 @@ func checkCmd(M *mod.Module, sy *mod.Symbol, scope *mod.Scope, n *mod.Node) *Err
 			return checkSe(M, sy, scope, n)
 		case lk.Enquanto:
 			return checkEnquanto(M, sy, scope, n)
+		case lk.Faca:
+			return checkFaca(M, sy, scope, n)
+		case lk.Escolha:
+			return checkEscolha(M, sy, scope, n)
 		case lk.Para:
 			return checkPara(M, sy, scope, n)
 		case lk.Retorne:
 			return checkRetorne(M, sy, scope, n)
+		case lk.Pare, lk.Continue:
+			n.T = T.T_Void
+			return nil
 		case lk.Assign:
 			return checkAtrib(M, scope, n)
 		}
+	case nk.CountedLoop:
+		return checkParaDe(M, sy, scope, n)
 	case nk.Block:
 		return checkBlock(M, sy, scope, n)
 	case nk.VarDecl:
 		return checkVarDecl(M, scope, n)
+	case nk.Call:
+		// o valor é descartado, então a chamada pode ser vazia
+		return checkCall(M, scope, n)
 	}
 	return checkExpr(M, scope, n)
 }
 
 func checkLeia(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
-	id := n.Leaves[0]
-	name := id.Lexeme.Text
-	sy := scope.Find(name)
-	id.T = sy.Type
+	alvo := n.Leaves[0]
+	err := checkExpr(M, scope, alvo)
+	if err != nil {
+		return err
+	}
+	if !T.IsValue(alvo.T) {
+		return errorExpectedValue(M, alvo)
+	}
+	if T.IsLogico(alvo.T) {
+		return errorCannotRead(M, alvo)
+	}
+	if isConstant(scope, alvo) {
+		return errorConstNotAssignable(M, alvo)
+	}
 	return nil
 }
 
@@ -165,90 +270,181 @@ func checkImprima(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
 	if err != nil {
 		return err
 	}
+	if !T.IsValue(arg.T) {
+		return errorExpectedValue(M, arg)
+	}
 	return nil
 }
 
+// as partes de um comando composto são checadas
+// mesmo que uma delas tenha erro
 func checkPara(M *mod.Module, sy *mod.Symbol, scope *mod.Scope, n *mod.Node) *Error {
 	initAtrib := n.Leaves[0]
-	var err *Error
 	if initAtrib != nil {
-		err = checkAtrib(M, scope, initAtrib)
-		if err != nil {
-			return err
-		}
+		addError(M, checkAtrib(M, scope, initAtrib))
 	}
+	addError(M, checkCond(M, scope, n, n.Leaves[1]))
 
-	expr := n.Leaves[1]
-	err = checkExpr(M, scope, expr)
+	repeatAtrib := n.Leaves[2]
+	addError(M, checkAtrib(M, scope, repeatAtrib))
+
+	bl := n.Leaves[3]
+	return checkBlock(M, sy, scope, bl)
+}
+
+// checkCond checa a condição 'expr' do comando 'n'
+func checkCond(M *mod.Module, scope *mod.Scope, n, expr *mod.Node) *Error {
+	err := checkExpr(M, scope, expr)
 	if err != nil {
 		return err
 	}
-	if !T.T_Inteiro.Equals(expr.T) {
+	if !isCondition(expr.T) {
 		return errorInvalidTypeForCond(M, n, expr.T)
 	}
+	return nil
+}
 
-	repeatAtrib := n.Leaves[2]
-	err = checkAtrib(M, scope, repeatAtrib)
+// o passo constante fica em n.Value, pra que cgen e o interpretador
+// saibam a direção do laço sem testar o sinal a cada iteração
+func checkParaDe(M *mod.Module, sy *mod.Symbol, scope *mod.Scope, n *mod.Node) *Error {
+	// paraDe := {id, inicio, fim, passo, block}
+	addError(M, checkContagem(M, scope, n))
+	bl := n.Leaves[4]
+	return checkBlock(M, sy, scope, bl)
+}
+
+// checkContagem checa a variavel, os limites e o passo de 'para ... de'
+func checkContagem(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
+	id := n.Leaves[0]
+	err := checkExpr(M, scope, id)
 	if err != nil {
 		return err
 	}
+	if isConstant(scope, id) {
+		return errorConstNotAssignable(M, id)
+	}
+	if !id.T.Equals(T.T_Inteiro) {
+		return errorInvalidTypeForPara(M, id)
+	}
 
-	bl := n.Leaves[3]
-	return checkBlock(M, sy, scope, bl)
+	for _, leaf := range n.Leaves[1:4] {
+		if leaf == nil {
+			continue
+		}
+		err = checkExpr(M, scope, leaf)
+		if err != nil {
+			return err
+		}
+		if !T.Assignable(T.T_Inteiro, leaf.T) {
+			return errorExpectedType(M, leaf, T.T_Inteiro)
+		}
+	}
+
+	passo := n.Leaves[3]
+	if passo == nil {
+		n.Value = int64(1)
+	} else if v, err := evalConst(M, scope, passo); err == nil {
+		if v.(int64) == 0 {
+			return errorZeroStep(M, passo)
+		}
+		n.Value = v.(int64)
+	}
+	return nil
 }
 
 func checkEnquanto(M *mod.Module, sy *mod.Symbol, scope *mod.Scope, n *mod.Node) *Error {
+	addError(M, checkCond(M, scope, n, n.Leaves[0]))
+	bl := n.Leaves[1]
+	return checkBlock(M, sy, scope, bl)
+}
+
+func checkFaca(M *mod.Module, sy *mod.Symbol, scope *mod.Scope, n *mod.Node) *Error {
+	// faca := {block, cond}
+	bl := n.Leaves[0]
+	checkBlock(M, sy, scope, bl)
+	return checkCond(M, scope, n, n.Leaves[1])
+}
+
+// os rotulos são calculados aqui e guardados nos nós,
+// já que o C só aceita constantes inteiras nos 'case'
+func checkEscolha(M *mod.Module, sy *mod.Symbol, scope *mod.Scope, n *mod.Node) *Error {
+	// escolha := {expr, caso...}
 	expr := n.Leaves[0]
 	err := checkExpr(M, scope, expr)
+	if err == nil && !expr.T.Equals(T.T_Inteiro) && !expr.T.Equals(T.T_Caractere) {
+		err = errorInvalidTypeForEscolha(M, expr)
+	}
+	// sem o tipo da expressão os rotulos não podem ser checados,
+	// mas os blocos ainda podem
+	addError(M, err)
+	seen := map[int64]bool{}
+	for _, c := range n.Leaves[1:] {
+		// caso := {labels, block}
+		// outrocaso := {block}
+		if c.Lexeme.Kind == lk.Caso && err == nil {
+			for _, label := range c.Leaves[0].Leaves {
+				addError(M, checkLabel(M, scope, expr, label, seen))
+			}
+		}
+		bl := c.Leaves[len(c.Leaves)-1]
+		checkBlock(M, sy, scope, bl)
+	}
+	return nil
+}
+
+func checkLabel(M *mod.Module, scope *mod.Scope, expr, label *mod.Node, seen map[int64]bool) *Error {
+	err := checkExpr(M, scope, label)
 	if err != nil {
 		return err
 	}
-	if !T.T_Inteiro.Equals(expr.T) {
-		return errorInvalidTypeForCond(M, n, expr.T)
+	if !T.IsScalar(label.T) || !T.Assignable(expr.T, label.T) {
+		return errorExpectedType(M, label, expr.T)
 	}
-	bl := n.Leaves[1]
-	err = checkBlock(M, sy, scope, bl)
+	v, err := evalConst(M, scope, label)
 	if err != nil {
-		return err
+		return errorCaseNotConstant(M, label, err)
 	}
+	value := v.(int64)
+	if seen[value] {
+		return errorDuplicateCase(M, label, value)
+	}
+	seen[value] = true
+	label.Value = value
 	return nil
 }
 
 func checkSe(M *mod.Module, sy *mod.Symbol, scope *mod.Scope, n *mod.Node) *Error {
-	expr := n.Leaves[0]
-	err := checkExpr(M, scope, expr)
-	if err != nil {
-		return err
-	}
-	if !T.T_Inteiro.Equals(expr.T) {
-		return errorInvalidTypeForCond(M, n, expr.T)
-	}
+	addError(M, checkCond(M, scope, n, n.Leaves[0]))
 
 	bl := n.Leaves[1]
-	err = checkBlock(M, sy, scope, bl)
-	if err != nil {
-		return err
-	}
+	checkBlock(M, sy, scope, bl)
 
 	senao := n.Leaves[2]
 	if senao != nil {
-		err = checkBlock(M, sy, scope, senao)
-		if err != nil {
-			return err
-		}
+		checkBlock(M, sy, scope, senao)
 	}
-
 	return nil
 }
 
+// procedimentos vazios só podem usar 'retorne' sem valor,
+// e os outros sempre precisam de um valor
 func checkRetorne(M *mod.Module, sy *mod.Symbol, scope *mod.Scope, n *mod.Node) *Error {
 	expr := n.Leaves[0]
+	retType := sy.Type.Proc.Ret
+	if T.IsVoid(retType) {
+		if expr != nil {
+			return errorReturnValueInVoid(M, expr, sy)
+		}
+		return nil
+	}
+	if expr == nil {
+		return errorMissingReturnValue(M, n, retType)
+	}
 	err := checkExpr(M, scope, expr)
 	if err != nil {
 		return err
 	}
-	retType := sy.Type.Proc.Ret
-	if !T.AssignmentTable[retType.Basic][expr.T.Basic] {
+	if !T.Assignable(retType, expr.T) {
 		return errorReturnTypeNotAssignable(M, expr, expr.T, sy.Type.Proc.Ret)
 	}
 	return nil
@@ -257,7 +453,7 @@ func checkRetorne(M *mod.Module, sy *mod.Symbol, scope *mod.Scope, n *mod.Node)
 func checkVarDecl(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
 	// vardecl := {type, id...}
 	tNode := n.Leaves[0]
-	t := t2T(tNode)
+	t := t2T(M, tNode)
 	tNode.T = t
 	for _, id := range n.Leaves[1:] {
 		name := id.Lexeme.Text
@@ -265,15 +461,36 @@ func checkVarDecl(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
 		if sy == nil {
 			panic("symbol was nil")
 		}
-		sy.Type = t
+		idT, err := declType(M, t, id)
+		if err != nil {
+			addError(M, err)
+			continue
+		}
+		id.T = idT
+		sy.Type = idT
 	}
 	return nil
 }
 
+// declType usa os tamanhos guardados nas folhas do identificador,
+// se houver, para construir o tipo do vetor.
+// 'real m[2][3]' é um vetor de 2 elementos do tipo real[3]
+func declType(M *mod.Module, t *T.Type, id *mod.Node) (*T.Type, *Error) {
+	for i := len(id.Leaves) - 1; i >= 0; i-- {
+		size := id.Leaves[i]
+		length := size.Lexeme.Value.(int64)
+		if length <= 0 {
+			return nil, errorInvalidArraySize(M, size)
+		}
+		t = T.NewArrayType(t, length)
+	}
+	return t, nil
+}
+
 type typeRule func(a, b *T.Type) *T.Type
 
-func outInt(a, b *T.Type) *T.Type {
-	return T.T_Inteiro
+func outLogico(a, b *T.Type) *T.Type {
+	return T.T_Logico
 }
 
 func convTable(a, b *T.Type) *T.Type {
@@ -287,11 +504,12 @@ func checkExpr(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
 	case nk.Terminal:
 		switch n.Lexeme.Kind {
 		case lk.Ou, lk.E:
-			return checkIntBinExpr(M, scope, n)
-		case lk.Equals, lk.Different,
-			lk.Greater, lk.GreaterOrEquals, lk.Less, lk.LessOrEquals:
-			return checkBinExpr(M, scope, n, outInt)
-		case lk.Plus, lk.Star, lk.Division:
+			return checkLogicalBinExpr(M, scope, n)
+		case lk.Equals, lk.Different:
+			return checkEquality(M, scope, n)
+		case lk.Greater, lk.GreaterOrEquals, lk.Less, lk.LessOrEquals:
+			return checkBinExpr(M, scope, n, outLogico)
+		case lk.Plus, lk.Star, lk.Division, lk.Caret:
 			return checkBinExpr(M, scope, n, convTable)
 		case lk.Remainder:
 			return checkIntBinExpr(M, scope, n)
@@ -301,20 +519,26 @@ func checkExpr(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
 				return err
 			}
 			aT := n.Leaves[0].T
-			if !aT.Equals(T.T_Inteiro) {
-				return errorExpectedType(M, n.Leaves[0], T.T_Inteiro)
+			if !isCondition(aT) {
+				return errorExpectedType(M, n.Leaves[0], T.T_Logico)
 			}
-			n.T = aT
+			n.T = T.T_Logico
+			return nil
 		case lk.Minus:
 			if len(n.Leaves) == 1 {
 				err := checkExpr(M, scope, n.Leaves[0])
 				if err != nil {
 					return err
 				}
+				if !T.IsScalar(n.Leaves[0].T) {
+					return errorExpectedScalar(M, n.Leaves[0])
+				}
 				n.T = n.Leaves[0].T
+				return nil
 			}
 			return checkBinExpr(M, scope, n, convTable)
-		case lk.IntLit, lk.RealLit, lk.CharLit:
+		case lk.IntLit, lk.RealLit, lk.CharLit, lk.StringLit,
+			lk.Verdadeiro, lk.Falso:
 			n.T = litToType(n)
 			return nil
 		case lk.Ident:
@@ -323,15 +547,115 @@ func checkExpr(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
 			if sy == nil {
 				panic("symbol not found")
 			}
+			if sy.Type == nil {
+				return errSilenced
+			}
 			n.T = sy.Type
 			return nil
 		}
 	case nk.Call:
-		return checkCall(M, scope, n)
+		err := checkCall(M, scope, n)
+		if err != nil {
+			return err
+		}
+		if T.IsVoid(n.T) {
+			return errorVoidAsValue(M, n)
+		}
+		return nil
+	case nk.Index:
+		return checkIndex(M, scope, n)
+	case nk.Field:
+		return checkField(M, scope, n)
 	}
 	panic("unreachable")
 }
 
+func checkField(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
+	// field := {registro, id}
+	reg := n.Leaves[0]
+	err := checkExpr(M, scope, reg)
+	if err != nil {
+		return err
+	}
+	if !T.IsRecord(reg.T) {
+		return errorExpectedRecord(M, reg)
+	}
+	id := n.Leaves[1]
+	field := reg.T.Record.Field(id.Lexeme.Text)
+	if field == nil {
+		return errorFieldNotFound(M, id, reg.T)
+	}
+	if field.T == nil {
+		return errSilenced
+	}
+	id.T = field.T
+	// o nome do campo é procurado no escopo do registro,
+	// que só é conhecido depois de saber o tipo
+	id.Scope = M.Global.Find(reg.T.Record.Name).N.Scope
+	n.T = field.T
+	return nil
+}
+
+// checkIndex verifica a cadeia de indices inteira de uma vez,
+// já que 'm[i][j]' é representado como index{index{m, i}, j}
+// e o vetor deve ser indexado até chegar num elemento escalar
+func checkIndex(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
+	// index := {vetor, expr}
+	indices := []*mod.Node{}
+	vetor := n
+	for vetor.Kind == nk.Index {
+		indices = append([]*mod.Node{vetor}, indices...)
+		vetor = vetor.Leaves[0]
+	}
+	err := checkExpr(M, scope, vetor)
+	if err != nil {
+		return err
+	}
+	if !T.IsArray(vetor.T) {
+		return errorExpectedArray(M, vetor)
+	}
+	dims := T.Dimensions(vetor.T)
+	if len(indices) != dims {
+		return errorWrongIndexCount(M, n, vetor, dims, len(indices))
+	}
+	t := vetor.T
+	for _, index := range indices {
+		idx := index.Leaves[1]
+		err = checkExpr(M, scope, idx)
+		if err != nil {
+			return err
+		}
+		if !T.Assignable(T.T_Inteiro, idx.T) {
+			return errorExpectedType(M, idx, T.T_Inteiro)
+		}
+		t = t.Array.Elem
+		index.T = t
+	}
+	return nil
+}
+
+// 'e' e 'ou' operam sobre valores logicos
+func checkLogicalBinExpr(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
+	err := checkExpr(M, scope, n.Leaves[0])
+	if err != nil {
+		return err
+	}
+	err = checkExpr(M, scope, n.Leaves[1])
+	if err != nil {
+		return err
+	}
+	aT := n.Leaves[0].T
+	if !isCondition(aT) {
+		return errorExpectedType(M, n.Leaves[0], T.T_Logico)
+	}
+	bT := n.Leaves[1].T
+	if !isCondition(bT) {
+		return errorExpectedType(M, n.Leaves[1], T.T_Logico)
+	}
+	n.T = T.T_Logico
+	return nil
+}
+
 func checkIntBinExpr(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
 	err := checkExpr(M, scope, n.Leaves[0])
 	if err != nil {
@@ -353,6 +677,37 @@ func checkIntBinExpr(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
 	return nil
 }
 
+// cadeias e valores logicos só podem ser
+// comparados com outros do mesmo tipo
+func checkEquality(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
+	left := n.Leaves[0]
+	right := n.Leaves[1]
+	err := checkExpr(M, scope, left)
+	if err != nil {
+		return err
+	}
+	err = checkExpr(M, scope, right)
+	if err != nil {
+		return err
+	}
+	if T.IsString(left.T) || T.IsString(right.T) ||
+		T.IsLogico(left.T) || T.IsLogico(right.T) {
+		if !left.T.Equals(right.T) {
+			return errorInvalidOperationUnequalTypes(M, n)
+		}
+		n.T = T.T_Logico
+		return nil
+	}
+	if !T.IsScalar(left.T) {
+		return errorExpectedScalar(M, left)
+	}
+	if !T.IsScalar(right.T) {
+		return errorExpectedScalar(M, right)
+	}
+	n.T = T.T_Logico
+	return nil
+}
+
 func checkBinExpr(M *mod.Module, scope *mod.Scope, n *mod.Node, rule typeRule) *Error {
 	err := checkExpr(M, scope, n.Leaves[0])
 	if err != nil {
@@ -363,7 +718,13 @@ func checkBinExpr(M *mod.Module, scope *mod.Scope, n *mod.Node, rule typeRule) *
 		return err
 	}
 	aT := n.Leaves[0].T
+	if !T.IsScalar(aT) {
+		return errorExpectedScalar(M, n.Leaves[0])
+	}
 	bT := n.Leaves[1].T
+	if !T.IsScalar(bT) {
+		return errorExpectedScalar(M, n.Leaves[1])
+	}
 	n.T = rule(aT, bT)
 	return nil
 }
@@ -376,6 +737,10 @@ func litToType(n *mod.Node) *T.Type {
 		return T.T_Real
 	case lk.CharLit:
 		return T.T_Caractere
+	case lk.StringLit:
+		return T.T_String
+	case lk.Verdadeiro, lk.Falso:
+		return T.T_Logico
 	}
 	return nil
 }
@@ -389,14 +754,25 @@ func checkCall(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
 	if !T.IsProc(proc.T) {
 		return errorExpectedProc(M, proc)
 	}
+	sy := scope.Find(proc.Lexeme.Text)
 	tArgs := proc.T.Proc.Args
 	args := n.Leaves[1]
+	if len(args.Leaves) != len(tArgs) {
+		return errorWrongArgCount(M, n, sy, len(args.Leaves))
+	}
 	for i, expr := range args.Leaves {
 		err := checkExpr(M, scope, expr)
 		if err != nil {
 			return err
 		}
-		if !T.AssignmentTable[tArgs[i].Basic][expr.T.Basic] {
+		if sy.Args[i].Ref {
+			err = checkRefArg(M, scope, expr, tArgs[i])
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !T.Assignable(tArgs[i], expr.T) {
 			return errorArgNotAssignable(M, n, tArgs[i])
 		}
 	}
@@ -404,26 +780,90 @@ func checkCall(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
 	return nil
 }
 
+// argumentos por referencia são apelidos pra variavel passada,
+// então não há conversão e só variaveis podem ser passadas
+func checkRefArg(M *mod.Module, scope *mod.Scope, expr *mod.Node, t *T.Type) *Error {
+	if !isVariable(scope, expr) {
+		return errorRefArgNotVariable(M, expr)
+	}
+	if !expr.T.Equals(t) {
+		return errorRefArgWrongType(M, expr, t)
+	}
+	return nil
+}
+
+// isVariable diz se a expressão é uma variavel, um elemento
+// de vetor ou um campo que pode ser modificado
+func isVariable(scope *mod.Scope, n *mod.Node) bool {
+	n = baseVar(n)
+	if n.Kind != nk.Terminal || n.Lexeme.Kind != lk.Ident {
+		return false
+	}
+	sy := scope.Find(n.Lexeme.Text)
+	switch sy.Kind {
+	case sk.Local, sk.Argument, sk.Global:
+		return true
+	}
+	return false
+}
+
 func checkAtrib(M *mod.Module, scope *mod.Scope, n *mod.Node) *Error {
-	id := n.Leaves[0]
-	name := id.Lexeme.Text
-	sy := scope.Find(name)
-	if sy == nil {
-		panic("symbol not found")
+	alvo := n.Leaves[0]
+	err := checkExpr(M, scope, alvo)
+	if err != nil {
+		return err
+	}
+	// registros são atribuidos inteiros, copiando todos os campos
+	if !T.IsValue(alvo.T) && !T.IsRecord(alvo.T) {
+		return errorExpectedValue(M, alvo)
+	}
+	if isConstant(scope, alvo) {
+		return errorConstNotAssignable(M, alvo)
 	}
 
 	expr := n.Leaves[1]
-	err := checkExpr(M, scope, expr)
+	err = checkExpr(M, scope, expr)
 	if err != nil {
 		return err
 	}
 
-	if !T.AssignmentTable[sy.Type.Basic][expr.T.Basic] {
-		return errorVarNotAssignable(M, n, expr.T, sy.Type)
+	if !T.Assignable(alvo.T, expr.T) {
+		return errorVarNotAssignable(M, n, expr.T, alvo.T)
 	}
 	return nil
 }
 
+// isConstant diz se o alvo de uma atribuição é uma constante
+func isConstant(scope *mod.Scope, alvo *mod.Node) bool {
+	alvo = baseVar(alvo)
+	sy := scope.Find(alvo.Lexeme.Text)
+	return sy != nil && sy.Kind == sk.Constant
+}
+
+// baseVar retorna a variavel sendo acessada por
+// uma sequencia de indices e campos
+func baseVar(n *mod.Node) *mod.Node {
+	for n.Kind == nk.Index || n.Kind == nk.Field {
+		n = n.Leaves[0]
+	}
+	return n
+}
+
+// accessText reconstroi o texto de um acesso como 'a.notas'
+// para as mensagens de erro, sem incluir os indices
+func accessText(n *mod.Node) string {
+	switch n.Kind {
+	case nk.Index:
+		return accessText(n.Leaves[0])
+	case nk.Field:
+		return accessText(n.Leaves[0]) + "." + n.Leaves[1].Lexeme.Text
+	}
+	return n.Lexeme.Text
+}
+
+// errSilenced não tem mensagem, ver addError
+var errSilenced = &Error{Code: ek.InternalCompilerError}
+
 func errorVarNotAssignable(M *mod.Module, n *mod.Node, t, u *T.Type) *Error {
 	tStr := colors.MakeBlue(t.String())
 	uStr := colors.MakeBlue(u.String())
@@ -431,6 +871,11 @@ func errorVarNotAssignable(M *mod.Module, n *mod.Node, t, u *T.Type) *Error {
 	return mod.NewError(M, ek.VarNotAssignable, n, msg)
 }
 
+func errorConstNotAssignable(M *mod.Module, n *mod.Node) *Error {
+	msg := "'" + n.Lexeme.Text + "' é uma constante e não pode ser modificada"
+	return mod.NewError(M, ek.VarNotAssignable, n, msg)
+}
+
 func errorReturnTypeNotAssignable(M *mod.Module, n *mod.Node, t, u *T.Type) *Error {
 	tStr := colors.MakeBlue(t.String())
 	uStr := colors.MakeBlue(u.String())
@@ -438,10 +883,51 @@ func errorReturnTypeNotAssignable(M *mod.Module, n *mod.Node, t, u *T.Type) *Err
 	return mod.NewError(M, ek.VarNotAssignable, n, msg)
 }
 
+func errorReturnValueInVoid(M *mod.Module, n *mod.Node, sy *mod.Symbol) *Error {
+	msg := "o procedimento '" + sy.Name + "' é " + colors.MakeBlue("vazio") + " e não pode retornar um valor"
+	return mod.NewError(M, ek.InvalidReturn, n, msg)
+}
+
+func errorMissingReturnValue(M *mod.Module, n *mod.Node, t *T.Type) *Error {
+	msg := "esperado um valor do tipo " + colors.MakeBlue(t.String()) + " após 'retorne'"
+	return mod.NewError(M, ek.InvalidReturn, n, msg)
+}
+
+func errorVoidAsValue(M *mod.Module, n *mod.Node) *Error {
+	msg := "o procedimento não retorna um valor e não pode ser usado numa expressão"
+	return mod.NewError(M, ek.VoidAsValue, n, msg)
+}
+
+func errorInvalidTypeForEscolha(M *mod.Module, n *mod.Node) *Error {
+	msg := "escolha espera um valor " + colors.MakeBlue("inteiro") + " ou " +
+		colors.MakeBlue("caractere") + " não " + colors.MakeBlue(n.T.String())
+	return mod.NewError(M, ek.ExpectedTypeOp, n, msg)
+}
+
+func errorCaseNotConstant(M *mod.Module, n *mod.Node, err *Error) *Error {
+	msg := "os rotulos de 'caso' devem ser constantes: " + err.Message
+	return mod.NewError(M, err.Code, n, msg)
+}
+
+func errorDuplicateCase(M *mod.Module, n *mod.Node, v int64) *Error {
+	msg := fmt.Sprintf("o caso %v aparece mais de uma vez", v)
+	return mod.NewError(M, ek.DuplicateCase, n, msg)
+}
+
+func errorInvalidTypeForPara(M *mod.Module, n *mod.Node) *Error {
+	msg := "a variavel do 'para' deve ser " + colors.MakeBlue("inteiro") +
+		" não " + colors.MakeBlue(n.T.String())
+	return mod.NewError(M, ek.ExpectedTypeOp, n, msg)
+}
+
+func errorZeroStep(M *mod.Module, n *mod.Node) *Error {
+	return mod.NewError(M, ek.InvalidStep, n, "o passo do 'para' não pode ser zero")
+}
+
 func errorInvalidTypeForCond(M *mod.Module, n *mod.Node, t *T.Type) *Error {
-	inteiro := colors.MakeBlue(T.T_Inteiro.String())
+	logico := colors.MakeBlue(T.T_Logico.String())
 	tStr := colors.MakeBlue(t.String())
-	msg := "expressão condicional deve ser " + inteiro + " não " + tStr
+	msg := "expressão condicional deve ser " + logico + " não " + tStr
 	return mod.NewError(M, ek.InvalidTypeForCond, n, msg)
 }
 
@@ -468,6 +954,24 @@ func errorArgNotAssignable(M *mod.Module, n *mod.Node, target *T.Type) *Error {
 	return mod.NewError(M, ek.ArgNotAssignable, n, msg)
 }
 
+func errorWrongArgCount(M *mod.Module, n *mod.Node, sy *mod.Symbol, has int) *Error {
+	msg := fmt.Sprintf("o procedimento '%v' espera %v argumentos, não %v",
+		sy.Name, len(sy.Args), has)
+	return mod.NewError(M, ek.ArgNotAssignable, n, msg)
+}
+
+func errorRefArgNotVariable(M *mod.Module, n *mod.Node) *Error {
+	msg := "apenas variaveis podem ser passadas para argumentos por referencia"
+	return mod.NewError(M, ek.ArgNotAssignable, n, msg)
+}
+
+func errorRefArgWrongType(M *mod.Module, n *mod.Node, target *T.Type) *Error {
+	expStr := colors.MakeBlue(target.String())
+	hasStr := colors.MakeBlue(n.T.String())
+	msg := "o argumento por referencia espera uma variavel do tipo " + expStr + " não " + hasStr
+	return mod.NewError(M, ek.ArgNotAssignable, n, msg)
+}
+
 func errorExpectedProc(M *mod.Module, n *mod.Node) *Error {
 	hasStr := colors.MakeBlue(n.T.String())
 	proc := colors.MakeBlue("procedimento")
@@ -475,6 +979,56 @@ func errorExpectedProc(M *mod.Module, n *mod.Node) *Error {
 	return mod.NewError(M, ek.ExpectedTypeOp, n, msg)
 }
 
+func errorExpectedScalar(M *mod.Module, n *mod.Node) *Error {
+	hasStr := colors.MakeBlue(n.T.String())
+	msg := "esperado um valor " + colors.MakeBlue("inteiro") + ", " +
+		colors.MakeBlue("real") + " ou " + colors.MakeBlue("caractere") + " não " + hasStr
+	return mod.NewError(M, ek.ExpectedTypeOp, n, msg)
+}
+
+func errorExpectedValue(M *mod.Module, n *mod.Node) *Error {
+	hasStr := colors.MakeBlue(n.T.String())
+	msg := "esperado um valor " + colors.MakeBlue("inteiro") + ", " +
+		colors.MakeBlue("real") + ", " + colors.MakeBlue("caractere") + ", " +
+		colors.MakeBlue("cadeia") + " ou " + colors.MakeBlue("logico") + " não " + hasStr
+	return mod.NewError(M, ek.ExpectedTypeOp, n, msg)
+}
+
+func errorCannotRead(M *mod.Module, n *mod.Node) *Error {
+	msg := "não é possivel ler um valor " + colors.MakeBlue(n.T.String())
+	return mod.NewError(M, ek.ExpectedTypeOp, n, msg)
+}
+
+func errorExpectedArray(M *mod.Module, n *mod.Node) *Error {
+	hasStr := colors.MakeBlue(n.T.String())
+	vetor := colors.MakeBlue("vetor")
+	msg := "esperado " + vetor + " não " + hasStr
+	return mod.NewError(M, ek.ExpectedTypeOp, n, msg)
+}
+
+func errorWrongIndexCount(M *mod.Module, n *mod.Node, vetor *mod.Node, dims, has int) *Error {
+	msg := fmt.Sprintf("'%v' tem %v dimensões mas foi indexado com %v indices",
+		accessText(vetor), dims, has)
+	return mod.NewError(M, ek.WrongIndexCount, n, msg)
+}
+
+func errorExpectedRecord(M *mod.Module, n *mod.Node) *Error {
+	hasStr := colors.MakeBlue(n.T.String())
+	registro := colors.MakeBlue("registro")
+	msg := "esperado " + registro + " não " + hasStr
+	return mod.NewError(M, ek.ExpectedTypeOp, n, msg)
+}
+
+func errorFieldNotFound(M *mod.Module, n *mod.Node, t *T.Type) *Error {
+	msg := "o registro " + colors.MakeBlue(t.String()) + " não tem o campo '" + n.Lexeme.Text + "'"
+	return mod.NewError(M, ek.FieldNotFound, n, msg)
+}
+
+func errorInvalidArraySize(M *mod.Module, n *mod.Node) *Error {
+	msg := "o tamanho do vetor deve ser maior que zero"
+	return mod.NewError(M, ek.InvalidArraySize, n, msg)
+}
+
 func errorWrongEntryType(M *mod.Module, n *mod.Node) *Error {
 	msg := "o procedimento de entrada deve receber zero argumentos e retornar um inteiro"
 	return mod.NewError(M, ek.WrongEntryType, n, msg)
@@ -0,0 +1,228 @@
+package warnings
+
+import (
+	. "upt/core"
+	mod "upt/core/module"
+
+	ek "upt/core/errorkind"
+	lk "upt/core/lexeme/lexkind"
+	nk "upt/core/module/nodekind"
+	sk "upt/core/module/symbolkind"
+)
+
+// Check procura variaveis e argumentos que nunca são usados,
+// procedimentos que não são alcançaveis a partir de 'entrada'
+// e declarações locais que escondem outro nome.
+// Os avisos vão para M.Warnings, e o modulo já deve estar tipado.
+func Check(M *mod.Module) {
+	ctx := &context{
+		M:        M,
+		Used:     map[*mod.Symbol]bool{},
+		Declared: mod.Declared{},
+		Calls:    map[*mod.Symbol][]*mod.Symbol{},
+	}
+	for _, sy := range M.Global.Symbols {
+		if sy.Kind != sk.Procedure {
+			continue
+		}
+		checkProc(ctx, sy)
+	}
+	checkCalls(ctx)
+}
+
+type context struct {
+	M *mod.Module
+
+	// simbolos que são lidos em alguma expressão
+	Used map[*mod.Symbol]bool
+	// locais cuja declaração já foi vista
+	Declared mod.Declared
+	// procedimentos usados por cada procedimento
+	Calls map[*mod.Symbol][]*mod.Symbol
+
+	Proc   *mod.Symbol
+	Locals []*mod.Symbol
+}
+
+func (this *context) warn(err *Error) {
+	this.M.Warnings = append(this.M.Warnings, err)
+}
+
+func checkProc(ctx *context, sy *mod.Symbol) {
+	ctx.Proc = sy
+	ctx.Locals = []*mod.Symbol{}
+
+	// proc := {id, args, retNode, bl}
+	argScope := sy.N.Scope
+	walk(ctx, argScope, sy.N.Leaves[3])
+
+	args := sy.N.Leaves[1]
+	if args != nil {
+		for _, arg := range args.Leaves {
+			// arg := {tipo, id, ref}
+			id := arg.Leaves[1]
+			if !ctx.Used[argScope.Symbols[id.Lexeme.Text]] {
+				ctx.warn(warningUnusedArgument(ctx.M, id, sy))
+			}
+		}
+	}
+	for _, local := range ctx.Locals {
+		if !ctx.Used[local] {
+			ctx.warn(warningUnusedLocal(ctx.M, local.N))
+		}
+	}
+}
+
+// walk marca os simbolos usados em n, trocando de escopo nos blocos
+func walk(ctx *context, scope *mod.Scope, n *mod.Node) {
+	if n == nil {
+		return
+	}
+	switch n.Kind {
+	case nk.Block:
+		scope = n.Scope
+	case nk.VarDecl:
+		declare(ctx, scope, n)
+		return
+	case nk.Field:
+		// field := {registro, id}
+		// o id é o nome do campo, não uma variavel
+		walk(ctx, scope, n.Leaves[0])
+		return
+	case nk.Terminal:
+		switch n.Lexeme.Kind {
+		case lk.Ident:
+			use(ctx, scope, n)
+			return
+		case lk.Assign:
+			// atrib := {alvo, expr}
+			assigned(ctx, scope, n.Leaves[0])
+			walk(ctx, scope, n.Leaves[1])
+			return
+		case lk.Leia:
+			// leia := {alvo}
+			assigned(ctx, scope, n.Leaves[0])
+			return
+		}
+	}
+	for _, leaf := range n.Leaves {
+		walk(ctx, scope, leaf)
+	}
+}
+
+// assigned percorre o alvo de uma atribuição, a variavel que recebe
+// o valor não conta como usada, mas os indices dela sim. Atribuir a
+// um argumento por referencia muda a variavel de quem chamou, então conta.
+func assigned(ctx *context, scope *mod.Scope, n *mod.Node) {
+	switch n.Kind {
+	case nk.Terminal:
+		if n.Lexeme.Kind == lk.Ident {
+			sy := ctx.Declared.Find(scope, n.Lexeme.Text)
+			if sy != nil && sy.Ref {
+				use(ctx, scope, n)
+			}
+			return
+		}
+	case nk.Index:
+		// index := {vetor, indice}
+		assigned(ctx, scope, n.Leaves[0])
+		walk(ctx, scope, n.Leaves[1])
+		return
+	case nk.Field:
+		// field := {registro, id}
+		assigned(ctx, scope, n.Leaves[0])
+		return
+	}
+	walk(ctx, scope, n)
+}
+
+func use(ctx *context, scope *mod.Scope, n *mod.Node) {
+	sy := ctx.Declared.Find(scope, n.Lexeme.Text)
+	if sy == nil {
+		return
+	}
+	ctx.Used[sy] = true
+	if sy.Kind == sk.Procedure && !sy.Builtin {
+		ctx.Calls[ctx.Proc] = append(ctx.Calls[ctx.Proc], sy)
+	}
+}
+
+// esconder um embutido não gera aviso,
+// já que eles podem ser redefinidos
+func declare(ctx *context, scope *mod.Scope, n *mod.Node) {
+	// vardecl := {type, id...}
+	for _, id := range n.Leaves[1:] {
+		name := id.Lexeme.Text
+		outer := ctx.Declared.Find(scope.Parent, name)
+		if outer != nil && !outer.Builtin {
+			ctx.warn(warningShadowedName(ctx.M, id, outer))
+		}
+		local := scope.Symbols[name]
+		ctx.Declared[local] = true
+		ctx.Locals = append(ctx.Locals, local)
+	}
+}
+
+// checkCalls avisa dos procedimentos que não podem ser
+// chamados, nem indiretamente, a partir de 'entrada'
+func checkCalls(ctx *context) {
+	entrada := ctx.M.Global.Symbols["entrada"]
+	reached := map[*mod.Symbol]bool{entrada: true}
+	stack := []*mod.Symbol{entrada}
+	for len(stack) > 0 {
+		sy := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, callee := range ctx.Calls[sy] {
+			if !reached[callee] {
+				reached[callee] = true
+				stack = append(stack, callee)
+			}
+		}
+	}
+	for _, sy := range ctx.M.Global.Symbols {
+		if sy.Kind == sk.Procedure && !reached[sy] {
+			ctx.warn(warningUnusedProcedure(ctx.M, sy))
+		}
+	}
+}
+
+// warnings -----------
+
+func warningUnusedLocal(M *mod.Module, id *mod.Node) *Error {
+	msg := "a variavel '" + id.Lexeme.Text + "' foi declarada mas nunca é usada"
+	return mod.NewWarning(M, ek.UnusedLocal, id, msg)
+}
+
+func warningUnusedArgument(M *mod.Module, id *mod.Node, proc *mod.Symbol) *Error {
+	msg := "o argumento '" + id.Lexeme.Text + "' de '" + proc.Name + "' nunca é usado"
+	return mod.NewWarning(M, ek.UnusedArgument, id, msg)
+}
+
+func warningUnusedProcedure(M *mod.Module, sy *mod.Symbol) *Error {
+	id := sy.N.Leaves[0]
+	msg := "o procedimento '" + sy.Name + "' nunca é chamado a partir de 'entrada'"
+	return mod.NewWarning(M, ek.UnusedProcedure, id, msg)
+}
+
+func warningShadowedName(M *mod.Module, id *mod.Node, outer *mod.Symbol) *Error {
+	msg := "a variavel '" + id.Lexeme.Text + "' esconde " + describe(outer) + " de mesmo nome"
+	return mod.NewWarning(M, ek.ShadowedName, id, msg)
+}
+
+func describe(sy *mod.Symbol) string {
+	switch sy.Kind {
+	case sk.Procedure:
+		return "o procedimento"
+	case sk.Global:
+		return "a variavel global"
+	case sk.Constant:
+		return "a constante"
+	case sk.Type:
+		return "o registro"
+	case sk.Argument:
+		return "o argumento"
+	case sk.Local:
+		return "a variavel local"
+	}
+	return "o simbolo"
+}